@@ -3,27 +3,33 @@ package application
 import (
 	"context"
 	"fmt"
+	"io/fs"
+	"time"
 
 	"github.com/cozy-hub-app/framework/env"
+	"github.com/cozy-hub-app/framework/health"
 	"github.com/cozy-hub-app/framework/logger"
+	"github.com/cozy-hub-app/framework/pgx"
+	"github.com/cozy-hub-app/framework/pgx/migrate"
+	"github.com/cozy-hub-app/framework/redis"
 )
 
 // Application represents the main application
 type Application struct {
-	logger         logger.Logger
-	pgxRegistrar   func(context.Context) error
-	redisConfig    *RedisConfig
-	awsConfig      *AWSConfig
-	errorHandler   ErrorHandler
+	logger          logger.Logger
+	pgxRegistrar    func(context.Context) error
+	migrations      []fs.FS
+	redisConfig     *RedisConfig
+	awsConfig       *AWSConfig
+	errorHandler    ErrorHandler
 	customValidator interface{}
+	components      []Component
+	shutdownTimeout time.Duration
+	initialized     bool
 }
 
 // RedisConfig holds Redis configuration
-type RedisConfig struct {
-	Host     string
-	Port     string
-	Password string
-}
+type RedisConfig = redis.Config
 
 // AWSConfig holds AWS configuration
 type AWSConfig struct {
@@ -46,18 +52,18 @@ func New() *Application {
 }
 
 // WithPgx configures PostgreSQL connection
-func (a *Application) WithPgx(registrar func(context.Context) error) *Application {
+// Optional migration sources (usually embed.FS holding <version>_<name>.<up|down>.sql files)
+// are applied during Run, before any component starts. The sources are merged into one set
+// tracked by a single table, so their versions must not overlap.
+func (a *Application) WithPgx(registrar func(context.Context) error, migrations ...fs.FS) *Application {
 	a.pgxRegistrar = registrar
+	a.migrations = migrations
 	return a
 }
 
 // WithRedis configures Redis connection
 func (a *Application) WithRedis() *Application {
-	a.redisConfig = &RedisConfig{
-		Host:     env.GetOrDefault(env.RedisHost, "localhost"),
-		Port:     env.GetOrDefault(env.RedisPort, "6379"),
-		Password: env.Get(env.RedisPassword),
-	}
+	a.redisConfig = redis.ConfigFromEnv()
 	return a
 }
 
@@ -97,12 +103,23 @@ func (a *Application) Run(ctx context.Context) error {
 			return fmt.Errorf("failed to initialize pgx: %w", err)
 		}
 		a.logger.Info("PostgreSQL connection initialized")
+
+		if err := a.migrate(ctx); err != nil {
+			return fmt.Errorf("failed to run migrations: %w", err)
+		}
+
+		if ds := pgx.GetDS(); ds != nil {
+			health.RegisterFunc("postgres", ds.Ping)
+		}
 	}
 
 	// Initialize Redis
 	if a.redisConfig != nil {
 		a.logger.Info("initializing Redis connection...")
-		// TODO: Add actual Redis initialization
+		if err := redis.InitWithConfig(ctx, a.redisConfig); err != nil {
+			return fmt.Errorf("failed to initialize redis: %w", err)
+		}
+		health.RegisterFunc("redis", redis.Ping)
 		a.logger.Info("Redis connection initialized")
 	}
 
@@ -113,6 +130,46 @@ func (a *Application) Run(ctx context.Context) error {
 		a.logger.Info("AWS services initialized")
 	}
 
+	a.initialized = true
 	a.logger.Info("application initialization completed")
 	return nil
-}
\ No newline at end of file
+}
+
+// migrate applies the pending migrations of all registered sources
+func (a *Application) migrate(ctx context.Context) error {
+	if len(a.migrations) == 0 {
+		return nil
+	}
+
+	ds := pgx.GetDS()
+	if ds == nil {
+		return fmt.Errorf("pgx registrar did not initialize the datasource")
+	}
+
+	// all sources share the migrations table, so they are applied as one set
+	migrations, err := migrate.LoadAll(a.migrations...)
+	if err != nil {
+		return err
+	}
+
+	count, err := migrate.NewFromMigrations(ds.GetPool(), migrations).Up(ctx)
+	if err != nil {
+		return err
+	}
+	a.logger.Info("database migrations applied", "count", count)
+
+	return nil
+}
+
+// Close releases the resources acquired during Run
+func (a *Application) Close() {
+	if ds := pgx.GetDS(); ds != nil {
+		ds.Close()
+	}
+
+	if a.redisConfig != nil {
+		if err := redis.Close(); err != nil {
+			a.logger.Error("failed to close redis client", "error", err)
+		}
+	}
+}
@@ -0,0 +1,6 @@
+package application
+
+// ParseShutdownTimeout exposes parseShutdownTimeout to the application_test package
+//
+//nolint:gochecknoglobals // test export
+var ParseShutdownTimeout = parseShutdownTimeout
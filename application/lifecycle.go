@@ -0,0 +1,289 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/cozy-hub-app/framework/env"
+	"github.com/cozy-hub-app/framework/health"
+	"github.com/cozy-hub-app/framework/server"
+)
+
+// defaultShutdownTimeout is used when neither WithShutdownTimeout nor SHUTDOWN_TIMEOUT is set
+const defaultShutdownTimeout = 30 * time.Second
+
+// Component is a long-running unit (server, pool, background worker) owned by the application
+type Component interface {
+	// Name identifies the component in logs and errors
+	Name() string
+	// Start runs the component and blocks until it stops serving.
+	// A non-nil error triggers the shutdown of the whole application.
+	Start(ctx context.Context) error
+	// Stop gracefully stops the component before ctx is done
+	Stop(ctx context.Context) error
+}
+
+// ReadyNotifier is implemented by components that take a while to serve, Serve waits for
+// Ready to be closed before starting the next component
+type ReadyNotifier interface {
+	Ready() <-chan struct{}
+}
+
+// readyComponent adds the readiness of a server to a Component
+type readyComponent struct {
+	Component
+	ready func() <-chan struct{}
+}
+
+func (c *readyComponent) Ready() <-chan struct{} {
+	return c.ready()
+}
+
+// funcComponent adapts plain functions to the Component interface
+type funcComponent struct {
+	name  string
+	start func(context.Context) error
+	stop  func(context.Context) error
+}
+
+// NewComponent creates a Component from start and stop functions, either may be nil
+func NewComponent(name string, start, stop func(context.Context) error) Component {
+	return &funcComponent{name: name, start: start, stop: stop}
+}
+
+func (c *funcComponent) Name() string {
+	return c.name
+}
+
+func (c *funcComponent) Start(ctx context.Context) error {
+	if c.start == nil {
+		return nil
+	}
+	return c.start(ctx)
+}
+
+func (c *funcComponent) Stop(ctx context.Context) error {
+	if c.stop == nil {
+		return nil
+	}
+	return c.stop(ctx)
+}
+
+// worker runs a background function until its context is canceled
+type worker struct {
+	name   string
+	fn     func(context.Context) error
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func (w *worker) Name() string {
+	return w.name
+}
+
+func (w *worker) Start(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	w.mu.Lock()
+	w.cancel, w.done = cancel, done
+	w.mu.Unlock()
+	defer close(done)
+
+	if err := w.fn(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+	return nil
+}
+
+func (w *worker) Stop(ctx context.Context) error {
+	w.mu.Lock()
+	cancel, done := w.cancel, w.done
+	w.mu.Unlock()
+
+	// never started
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// WithComponent registers a component, components are started in registration order
+// and stopped in reverse order
+func (a *Application) WithComponent(c Component) *Application {
+	a.components = append(a.components, c)
+	return a
+}
+
+// WithWorker registers a background worker, its context is canceled on shutdown
+func (a *Application) WithWorker(name string, fn func(context.Context) error) *Application {
+	return a.WithComponent(&worker{name: name, fn: fn})
+}
+
+// WithGRPCServer registers the gRPC server as a component
+func (a *Application) WithGRPCServer(s *server.GRPCServer) *Application {
+	return a.WithComponent(&readyComponent{
+		Component: NewComponent("grpc server",
+			func(context.Context) error { return s.ListenAndServe() },
+			s.ShutdownWithContext,
+		),
+		ready: s.Ready,
+	})
+}
+
+// WithGateway registers the HTTP gateway as a component
+func (a *Application) WithGateway(g *server.Gateway) *Application {
+	return a.WithComponent(&readyComponent{
+		Component: NewComponent("http gateway",
+			func(context.Context) error { return ignoreServerClosed(g.ListenAndServe()) },
+			g.Shutdown,
+		),
+		ready: g.Ready,
+	})
+}
+
+// WithProfiler registers the pprof server as a component
+func (a *Application) WithProfiler() *Application {
+	p := server.NewProfiler()
+	return a.WithComponent(NewComponent("profiler",
+		func(context.Context) error { return ignoreServerClosed(p.ListenAndServe()) },
+		p.Shutdown,
+	))
+}
+
+// WithHealthCheck registers a custom readiness checker
+func (a *Application) WithHealthCheck(name string, checker health.Checker) *Application {
+	health.Register(name, checker)
+	return a
+}
+
+// WithShutdownTimeout sets the deadline for draining all components on shutdown
+func (a *Application) WithShutdownTimeout(timeout time.Duration) *Application {
+	a.shutdownTimeout = timeout
+	return a
+}
+
+// Serve initializes the dependencies (if Run was not called yet), starts the registered
+// components in order, each after the previous one is ready (see ReadyNotifier), and blocks
+// until SIGINT/SIGTERM, ctx cancellation or a component failure.
+// Components are then stopped in reverse order within the shutdown timeout.
+func (a *Application) Serve(ctx context.Context) error {
+	if !a.initialized {
+		if err := a.Run(ctx); err != nil {
+			return err
+		}
+	}
+
+	sigCtx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	runCtx, cancel := context.WithCancel(sigCtx)
+	defer cancel()
+
+	errCh := make(chan error, len(a.components))
+	started, runErr := a.startComponents(sigCtx, runCtx, errCh)
+	if started {
+		select {
+		case <-sigCtx.Done():
+			a.logger.Info("shutdown signal received")
+		case runErr = <-errCh:
+			a.logger.Error("component failed, shutting down", "error", runErr)
+		}
+	}
+
+	cancel()
+	return errors.Join(runErr, a.Shutdown(context.Background()))
+}
+
+// startComponents starts the components in order and waits for each to be ready.
+// It reports false when a signal or a component failure interrupted the startup.
+func (a *Application) startComponents(sigCtx, runCtx context.Context, errCh chan error) (bool, error) {
+	for _, c := range a.components {
+		a.logger.Info("starting component", "component", c.Name())
+		go func(c Component) {
+			if err := c.Start(runCtx); err != nil {
+				errCh <- fmt.Errorf("%s: %w", c.Name(), err)
+			}
+		}(c)
+
+		notifier, ok := c.(ReadyNotifier)
+		if !ok {
+			continue
+		}
+		select {
+		case <-notifier.Ready():
+		case <-sigCtx.Done():
+			a.logger.Info("shutdown signal received during startup")
+			return false, nil
+		case err := <-errCh:
+			a.logger.Error("component failed to start, shutting down", "error", err)
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// Shutdown stops all components in reverse registration order and releases the
+// dependencies acquired during Run. Readiness flips to not-serving first.
+func (a *Application) Shutdown(ctx context.Context) error {
+	health.Shutdown()
+
+	ctx, cancel := context.WithTimeout(ctx, a.getShutdownTimeout())
+	defer cancel()
+
+	var errs []error
+	for i := len(a.components) - 1; i >= 0; i-- {
+		c := a.components[i]
+		a.logger.Info("stopping component", "component", c.Name())
+		if err := c.Stop(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to stop %s: %w", c.Name(), err))
+		}
+	}
+
+	a.Close()
+	a.logger.Info("application shutdown completed")
+
+	return errors.Join(errs...)
+}
+
+// getShutdownTimeout returns the configured shutdown deadline
+func (a *Application) getShutdownTimeout() time.Duration {
+	if a.shutdownTimeout > 0 {
+		return a.shutdownTimeout
+	}
+	timeout, err := parseShutdownTimeout(env.Get(env.ShutdownTimeout))
+	if err != nil {
+		a.logger.Warn("ignoring invalid SHUTDOWN_TIMEOUT", "error", err)
+	}
+	if timeout > 0 {
+		return timeout
+	}
+	return defaultShutdownTimeout
+}
+
+// parseShutdownTimeout parses a duration ("45s", "1m"), a bare number is a count of seconds
+func parseShutdownTimeout(value string) (time.Duration, error) {
+	return env.ParseDuration(value)
+}
+
+// ignoreServerClosed treats the error returned after a graceful shutdown as success
+func ignoreServerClosed(err error) error {
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,195 @@
+package application_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cozy-hub-app/framework/application"
+)
+
+// recorder collects the lifecycle events of the test components in order
+type recorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *recorder) record(event string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *recorder) get() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.events...)
+}
+
+// testComponent serves until its context is canceled, or fails with startErr once started
+type testComponent struct {
+	name     string
+	rec      *recorder
+	ready    chan struct{}
+	startErr error
+}
+
+func (c *testComponent) Name() string {
+	return c.name
+}
+
+func (c *testComponent) Start(ctx context.Context) error {
+	c.rec.record("start " + c.name)
+	if c.startErr != nil {
+		return c.startErr
+	}
+	<-ctx.Done()
+	return nil
+}
+
+func (c *testComponent) Stop(context.Context) error {
+	c.rec.record("stop " + c.name)
+	return nil
+}
+
+// readyTestComponent is a testComponent implementing application.ReadyNotifier
+type readyTestComponent struct {
+	*testComponent
+}
+
+func (c readyTestComponent) Ready() <-chan struct{} {
+	return c.ready
+}
+
+func TestServeStartsInOrderAndStopsInReverse(t *testing.T) {
+	rec := &recorder{}
+	first := readyTestComponent{&testComponent{name: "first", rec: rec, ready: make(chan struct{})}}
+	second := &testComponent{name: "second", rec: rec}
+
+	app := application.New().WithComponent(first).WithComponent(second).WithShutdownTimeout(time.Second)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan error, 1)
+	go func() { done <- app.Serve(ctx) }()
+
+	require.Eventually(t, func() bool { return len(rec.get()) == 1 }, time.Second, time.Millisecond)
+	// the second component waits for the first one to be ready
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, []string{"start first"}, rec.get())
+
+	close(first.ready)
+	require.Eventually(t, func() bool { return len(rec.get()) == 2 }, time.Second, time.Millisecond)
+
+	cancel()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Serve did not return after cancellation")
+	}
+
+	assert.Equal(t, []string{"start first", "start second", "stop second", "stop first"}, rec.get())
+}
+
+func TestServeShutsDownOnComponentFailure(t *testing.T) {
+	errBoom := errors.New("boom")
+
+	tests := []struct {
+		name        string
+		components  func(rec *recorder) []application.Component
+		wantStopped []string
+	}{
+		{
+			name: "Should shut down when a component fails while serving",
+			components: func(rec *recorder) []application.Component {
+				return []application.Component{
+					&testComponent{name: "server", rec: rec},
+					&testComponent{name: "worker", rec: rec, startErr: errBoom},
+				}
+			},
+			wantStopped: []string{"stop worker", "stop server"},
+		},
+		{
+			name: "Should shut down when a component fails before it is ready",
+			components: func(rec *recorder) []application.Component {
+				return []application.Component{
+					readyTestComponent{&testComponent{name: "server", rec: rec, ready: make(chan struct{}), startErr: errBoom}},
+					&testComponent{name: "worker", rec: rec},
+				}
+			},
+			wantStopped: []string{"stop worker", "stop server"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := &recorder{}
+			app := application.New().WithShutdownTimeout(time.Second)
+			for _, c := range tt.components(rec) {
+				app.WithComponent(c)
+			}
+
+			done := make(chan error, 1)
+			go func() { done <- app.Serve(t.Context()) }()
+
+			select {
+			case err := <-done:
+				require.ErrorIs(t, err, errBoom)
+			case <-time.After(time.Second):
+				t.Fatal("Serve did not return after the component failure")
+			}
+			// components started without a ReadyNotifier run concurrently, only the stop order is fixed
+			var stopped []string
+			for _, event := range rec.get() {
+				if strings.HasPrefix(event, "stop ") {
+					stopped = append(stopped, event)
+				}
+			}
+			assert.Equal(t, tt.wantStopped, stopped)
+		})
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	stuck := application.NewComponent("stuck", nil, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	app := application.New().WithComponent(stuck).WithShutdownTimeout(20 * time.Millisecond)
+
+	start := time.Now()
+	err := app.Shutdown(t.Context())
+
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestParseShutdownTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"Should default an empty value to zero", "", 0, false},
+		{"Should read a bare number as seconds", "45", 45 * time.Second, false},
+		{"Should parse a Go duration", "1m30s", 90 * time.Second, false},
+		{"Should reject an invalid value", "soon", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := application.ParseShutdownTimeout(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
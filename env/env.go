@@ -4,33 +4,64 @@ import (
 	"bufio"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 // Environment variable keys
 const (
-	Service        = "SERVICE_NAME"
-	Environment    = "ENVIRONMENT"
-	ServerPort     = "SERVER_PORT"
-	GRPCPort       = "GRPC_PORT"
-	DBHost         = "DB_HOST"
-	DBPort         = "DB_PORT"
-	DBUser         = "DB_USER"
-	DBPassword     = "DB_PASSWORD"
-	DBName         = "DB_NAME"
-	DBDrivers      = "DB_DRIVERS"
-	RedisHost      = "REDIS_HOST"
-	RedisPort      = "REDIS_PORT"
-	RedisPassword  = "REDIS_PASSWORD"
-	AWSRegion           = "AWS_REGION"
-	SQSQueueURL         = "SQS_QUEUE_URL"
-	S3Bucket            = "S3_BUCKET"
-	JWTSecretKey        = "JWT_SECRET_KEY"
-	JWTAccessTokenTTL   = "JWT_ACCESS_TOKEN_TTL"
-	JWTRefreshTokenTTL  = "JWT_REFRESH_TOKEN_TTL"
-	JWTIssuer           = "JWT_ISSUER"
+	Service                    = "SERVICE_NAME"
+	Environment                = "ENVIRONMENT"
+	ServerPort                 = "SERVER_PORT"
+	GRPCPort                   = "GRPC_PORT"
+	DBHost                     = "DB_HOST"
+	DBPort                     = "DB_PORT"
+	DBUser                     = "DB_USER"
+	DBPassword                 = "DB_PASSWORD"
+	DBName                     = "DB_NAME"
+	DBDrivers                  = "DB_DRIVERS"
+	DatabaseURL                = "DATABASE_URL"
+	DBSSLMode                  = "DB_SSLMODE"
+	DBSSLRootCert              = "DB_SSLROOTCERT"
+	DBSSLCert                  = "DB_SSLCERT"
+	DBSSLKey                   = "DB_SSLKEY"
+	DBMaxConns                 = "DB_MAX_CONNS"
+	DBMinConns                 = "DB_MIN_CONNS"
+	DBMaxConnLifetime          = "DB_MAX_CONN_LIFETIME"
+	DBMaxConnIdleTime          = "DB_MAX_CONN_IDLE_TIME"
+	DBHealthCheckPeriod        = "DB_HEALTH_CHECK_PERIOD"
+	DatabaseReplicaURLs        = "DATABASE_REPLICA_URLS"
+	DBReplicaHosts             = "DB_REPLICA_HOSTS"
+	DBReplicaHealthCheckPeriod = "DB_REPLICA_HEALTH_CHECK_PERIOD"
+	RedisHost                  = "REDIS_HOST"
+	RedisPort                  = "REDIS_PORT"
+	RedisPassword              = "REDIS_PASSWORD"
+	RedisDB                    = "REDIS_DB"
+	AWSRegion                  = "AWS_REGION"
+	SQSQueueURL                = "SQS_QUEUE_URL"
+	S3Bucket                   = "S3_BUCKET"
+	JWTSecretKey               = "JWT_SECRET_KEY"
+	JWTAccessTokenTTL          = "JWT_ACCESS_TOKEN_TTL"
+	JWTRefreshTokenTTL         = "JWT_REFRESH_TOKEN_TTL"
+	JWTIssuer                  = "JWT_ISSUER"
+	JWTAlgorithm               = "JWT_ALGORITHM"
+	JWTKeyID                   = "JWT_KEY_ID"
+	JWTPrivateKeyFile          = "JWT_PRIVATE_KEY_FILE"
+	JWTVerificationKeyFiles    = "JWT_VERIFICATION_KEY_FILES"
+	JWTJWKSURL                 = "JWT_JWKS_URL"
+	JWTAudience                = "JWT_AUDIENCE"
+	JWTLeeway                  = "JWT_LEEWAY"
+	ShutdownTimeout            = "SHUTDOWN_TIMEOUT"
+	TrustedProxies             = "TRUSTED_PROXIES"
+	TrustedProxyHeader         = "TRUSTED_PROXY_HEADER"
+	RateLimitPolicyFile        = "RATE_LIMIT_POLICY_FILE"
+	CSRFSecret                 = "CSRF_SECRET"
+	CORSAllowedOrigins         = "CORS_ALLOWED_ORIGINS"
+	LogLevel                   = "LOG_LEVEL"
+	LogFormat                  = "LOG_FORMAT"
 )
 
 // Environment types
@@ -75,6 +106,19 @@ func GetList(key string) []string {
 	return result
 }
 
+// ParseDuration parses a duration ("45s", "1m"), a bare number is a count of seconds.
+// An empty value is zero.
+func ParseDuration(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return time.ParseDuration(value)
+}
+
 // LoadFromEnv loads environment variables from a .env file
 func LoadFromEnv(filePath string) error {
 	file, err := os.Open(filePath)
@@ -148,6 +192,21 @@ func LoadFromYAML(filePath string) error {
 	return nil
 }
 
+// LoadYAMLInto decodes a structured YAML file into out, ${VAR} references are expanded
+// from the environment before decoding
+func LoadYAMLInto(filePath string, out interface{}) error {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read YAML file: %w", err)
+	}
+
+	if err := yaml.Unmarshal([]byte(os.ExpandEnv(string(data))), out); err != nil {
+		return fmt.Errorf("failed to parse YAML: %w", err)
+	}
+
+	return nil
+}
+
 // Validate checks that all required environment variables are set
 func Validate(requiredVars ...string) error {
 	var missing []string
@@ -162,4 +221,4 @@ func Validate(requiredVars ...string) error {
 	}
 
 	return nil
-}
\ No newline at end of file
+}
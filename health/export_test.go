@@ -0,0 +1,9 @@
+package health
+
+// Reset clears the checkers and the shutdown state between tests
+func Reset() {
+	mu.Lock()
+	checkers = make(map[string]Checker)
+	mu.Unlock()
+	shuttingDown.Store(false)
+}
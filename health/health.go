@@ -0,0 +1,104 @@
+package health
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// checkTimeout bounds every single readiness check
+const checkTimeout = 2 * time.Second
+
+// Checker probes a dependency, a non-nil error marks the service as not ready
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// CheckerFunc adapts a function to the Checker interface
+type CheckerFunc func(ctx context.Context) error
+
+// Check calls f(ctx)
+func (f CheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Result is the outcome of a readiness evaluation
+type Result struct {
+	Ready  bool              `json:"ready"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+//nolint:gochecknoglobals // process wide health state shared by the gRPC and HTTP servers
+var (
+	mu           sync.RWMutex
+	checkers     = make(map[string]Checker)
+	shuttingDown atomic.Bool
+)
+
+// Register adds a named readiness checker, registering the same name twice replaces it
+func Register(name string, checker Checker) {
+	mu.Lock()
+	defer mu.Unlock()
+	checkers[name] = checker
+}
+
+// RegisterFunc adds a named readiness check function
+func RegisterFunc(name string, fn func(ctx context.Context) error) {
+	Register(name, CheckerFunc(fn))
+}
+
+// Shutdown flips readiness to not-serving so load balancers stop routing new traffic
+func Shutdown() {
+	shuttingDown.Store(true)
+}
+
+// IsShuttingDown reports whether Shutdown was called
+func IsShuttingDown() bool {
+	return shuttingDown.Load()
+}
+
+// Ready runs every registered checker concurrently and aggregates the results
+func Ready(ctx context.Context) Result {
+	if IsShuttingDown() {
+		return Result{Ready: false, Checks: map[string]string{"shutdown": "shutting down"}}
+	}
+
+	mu.RLock()
+	names := make([]string, 0, len(checkers))
+	for name := range checkers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	snapshot := make([]Checker, len(names))
+	for i, name := range names {
+		snapshot[i] = checkers[name]
+	}
+	mu.RUnlock()
+
+	errs := make([]error, len(names))
+	var wg sync.WaitGroup
+	for i, checker := range snapshot {
+		wg.Add(1)
+		go func(i int, checker Checker) {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, checkTimeout)
+			defer cancel()
+			errs[i] = checker.Check(checkCtx)
+		}(i, checker)
+	}
+	wg.Wait()
+
+	result := Result{Ready: true, Checks: make(map[string]string, len(names))}
+	for i, name := range names {
+		if errs[i] != nil {
+			result.Ready = false
+			result.Checks[name] = errs[i].Error()
+			continue
+		}
+		result.Checks[name] = "ok"
+	}
+
+	return result
+}
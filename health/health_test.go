@@ -0,0 +1,32 @@
+package health_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cozy-hub-app/framework/health"
+)
+
+func TestReady(t *testing.T) {
+	t.Cleanup(health.Reset)
+	ctx := context.Background()
+
+	health.RegisterFunc("postgres", func(context.Context) error { return nil })
+	assert.Equal(t, health.Result{Ready: true, Checks: map[string]string{"postgres": "ok"}}, health.Ready(ctx))
+
+	health.RegisterFunc("redis", func(context.Context) error { return errors.New("connection refused") })
+	assert.Equal(t, health.Result{
+		Ready:  false,
+		Checks: map[string]string{"postgres": "ok", "redis": "connection refused"},
+	}, health.Ready(ctx))
+
+	health.RegisterFunc("redis", func(context.Context) error { return nil })
+	assert.True(t, health.Ready(ctx).Ready)
+
+	health.Shutdown()
+	assert.True(t, health.IsShuttingDown())
+	assert.False(t, health.Ready(ctx).Ready)
+}
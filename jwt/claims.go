@@ -0,0 +1,65 @@
+package jwt
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WithAudience sets the audience required on validation, it is also the default audience of issued tokens
+func (m *JWTManager) WithAudience(audience ...string) *JWTManager {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.audience = audience
+	return m
+}
+
+// WithLeeway tolerates clock skew between issuer and verifiers when checking exp, nbf and iat
+func (m *JWTManager) WithLeeway(leeway time.Duration) *JWTManager {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.leeway = leeway
+	return m
+}
+
+// IssueTokenPair generates an access and refresh token pair sharing a new token family.
+// Identity, tenant, session, scopes, custom claims, subject and audience are taken from claims;
+// jti, token type, family, issuer and lifetimes are set by the manager.
+//
+//	claims := jwt.JWTClaims{UserID: id, TenantID: tenant, Scopes: []string{"orders:read"}}
+//	claims.Audience = []string{"storefront"}
+//	_ = jwt.SetCustomClaims(&claims, StoreClaims{StoreID: storeID})
+//	access, refresh, err := m.IssueTokenPair(claims)
+func (m *JWTManager) IssueTokenPair(claims JWTClaims) (accessToken string, refreshToken string, err error) {
+	return m.generatePair(claims, uuid.NewString())
+}
+
+// HasScope reports whether the token grants scope
+func (c *JWTClaims) HasScope(scope string) bool {
+	return slices.Contains(c.Scopes, scope)
+}
+
+// SetCustomClaims stores service specific claims in the "ext" claim
+func SetCustomClaims[T any](claims *JWTClaims, custom T) error {
+	raw, err := json.Marshal(custom)
+	if err != nil {
+		return fmt.Errorf("failed to encode custom claims: %w", err)
+	}
+	claims.Custom = raw
+	return nil
+}
+
+// CustomClaims decodes the "ext" claim into T, the zero value is returned when the token has none
+func CustomClaims[T any](claims *JWTClaims) (T, error) {
+	var custom T
+	if claims == nil || len(claims.Custom) == 0 {
+		return custom, nil
+	}
+	if err := json.Unmarshal(claims.Custom, &custom); err != nil {
+		return custom, fmt.Errorf("failed to decode custom claims: %w", err)
+	}
+	return custom, nil
+}
@@ -0,0 +1,51 @@
+package jwt_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cozy-hub-app/framework/jwt"
+)
+
+type storeClaims struct {
+	StoreID string `json:"store_id"`
+}
+
+func TestCustomClaimsAndAudience(t *testing.T) {
+	ctx := context.Background()
+	issuer := jwt.NewJWTManager(testSecret, time.Minute, time.Hour, "test").WithStore(jwt.NewMemoryStore())
+
+	claims := jwt.JWTClaims{UserID: "user-1", TenantID: "tenant-1", Scopes: []string{"orders:read"}}
+	claims.Audience = []string{"storefront"}
+	require.NoError(t, jwt.SetCustomClaims(&claims, storeClaims{StoreID: "store-1"}))
+
+	_, refresh, err := issuer.IssueTokenPair(claims)
+	require.NoError(t, err)
+
+	// custom claims survive the refresh rotation
+	access, _, err := issuer.Refresh(ctx, refresh)
+	require.NoError(t, err)
+
+	storefront := jwt.NewJWTManager(testSecret, time.Minute, time.Hour, "test").WithAudience("storefront")
+	got, err := storefront.ValidateAccessToken(ctx, access)
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", got.Subject)
+	assert.Equal(t, "tenant-1", got.TenantID)
+	assert.True(t, got.HasScope("orders:read"))
+
+	custom, err := jwt.CustomClaims[storeClaims](got)
+	require.NoError(t, err)
+	assert.Equal(t, "store-1", custom.StoreID)
+
+	admin := jwt.NewJWTManager(testSecret, time.Minute, time.Hour, "test").WithAudience("admin")
+	_, err = admin.ValidateAccessToken(ctx, access)
+	assert.ErrorIs(t, err, jwt.ErrInvalidToken, "Should reject a token issued for another audience")
+
+	other := jwt.NewJWTManager(testSecret, time.Minute, time.Hour, "other")
+	_, err = other.ValidateAccessToken(ctx, access)
+	assert.ErrorIs(t, err, jwt.ErrInvalidToken, "Should reject a token from another issuer")
+}
@@ -0,0 +1,316 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// JWK key types and curves
+const (
+	ktyRSA = "RSA"
+	ktyEC  = "EC"
+	ktyOKP = "OKP"
+
+	crvP256    = "P-256"
+	crvEd25519 = "Ed25519"
+
+	useSig = "sig"
+)
+
+// jwksRefreshInterval limits how often a remote JWKS is fetched on unknown kids
+const jwksRefreshInterval = time.Minute
+
+// jwksFetchTimeout bounds a remote JWKS request
+const jwksFetchTimeout = 5 * time.Second
+
+// maxJWKSSize bounds the remote JWKS document
+const maxJWKSSize = 1 << 20
+
+// p256CoordinateSize is the fixed length of P-256 coordinates in a JWK
+const p256CoordinateSize = 32
+
+// JWK is a public JSON Web Key (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set document
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// ParseJWKS parses a JWKS document into verification keys, keys not used for signatures are skipped
+func ParseJWKS(data []byte) ([]*Key, error) {
+	var set JWKS
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+
+	keys := make([]*Key, 0, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != useSig {
+			continue
+		}
+		key, err := jwk.Key()
+		if err != nil {
+			return nil, fmt.Errorf("kid %q: %w", jwk.Kid, err)
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// Key converts the JWK to a verification key
+func (j JWK) Key() (*Key, error) {
+	public, err := j.publicKey()
+	if err != nil {
+		return nil, err
+	}
+	return NewVerificationKey(j.Kid, public)
+}
+
+// publicKey decodes the key material of the JWK
+func (j JWK) publicKey() (crypto.PublicKey, error) {
+	switch j.Kty {
+	case ktyRSA:
+		n, err := decodeBigInt(j.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(j.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case ktyEC:
+		if j.Crv != crvP256 {
+			return nil, fmt.Errorf("%w: curve %s", ErrUnsupportedKey, j.Crv)
+		}
+		x, err := decodeBigInt(j.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(j.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, errors.New("EC point is not on the P-256 curve")
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+
+	case ktyOKP:
+		if j.Crv != crvEd25519 {
+			return nil, fmt.Errorf("%w: curve %s", ErrUnsupportedKey, j.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 public key")
+		}
+		return ed25519.PublicKey(x), nil
+
+	default:
+		return nil, fmt.Errorf("%w: kty %s", ErrUnsupportedKey, j.Kty)
+	}
+}
+
+// JWK returns the public JWK of an asymmetric key, false for HMAC keys
+func (k *Key) JWK() (JWK, bool) {
+	if !k.IsAsymmetric() {
+		return JWK{}, false
+	}
+
+	jwk, err := publicJWK(k.verifyKey)
+	if err != nil {
+		return JWK{}, false
+	}
+	jwk.Kid = k.ID
+	jwk.Use = useSig
+	jwk.Alg = k.Algorithm
+	return jwk, true
+}
+
+// publicJWK encodes the required members of a public key
+func publicJWK(public crypto.PublicKey) (JWK, error) {
+	switch k := public.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: ktyRSA,
+			N:   base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+		}, nil
+	case *ecdsa.PublicKey:
+		return JWK{
+			Kty: ktyEC,
+			Crv: crvP256,
+			X:   base64.RawURLEncoding.EncodeToString(k.X.FillBytes(make([]byte, p256CoordinateSize))),
+			Y:   base64.RawURLEncoding.EncodeToString(k.Y.FillBytes(make([]byte, p256CoordinateSize))),
+		}, nil
+	case ed25519.PublicKey:
+		return JWK{
+			Kty: ktyOKP,
+			Crv: crvEd25519,
+			X:   base64.RawURLEncoding.EncodeToString(k),
+		}, nil
+	default:
+		return JWK{}, fmt.Errorf("%w: %T", ErrUnsupportedKey, public)
+	}
+}
+
+// thumbprint computes the RFC 7638 JWK thumbprint used as default kid
+func thumbprint(public crypto.PublicKey) (string, error) {
+	jwk, err := publicJWK(public)
+	if err != nil {
+		return "", err
+	}
+
+	// required members only, in lexicographic order
+	var members string
+	switch jwk.Kty {
+	case ktyRSA:
+		members = fmt.Sprintf(`{"e":%q,"kty":%q,"n":%q}`, jwk.E, jwk.Kty, jwk.N)
+	case ktyEC:
+		members = fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q,"y":%q}`, jwk.Crv, jwk.Kty, jwk.X, jwk.Y)
+	default:
+		members = fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q}`, jwk.Crv, jwk.Kty, jwk.X)
+	}
+
+	sum := sha256.Sum256([]byte(members))
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// decodeBigInt decodes a base64url encoded unsigned big-endian integer
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("invalid base64url integer")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// remoteJWKS caches the keys published by another service
+type remoteJWKS struct {
+	url       string
+	client    *http.Client
+	mu        sync.RWMutex
+	keys      map[string]*Key
+	fetchedAt time.Time
+	// refreshMu coalesces the refreshes triggered by concurrent unknown kids
+	refreshMu sync.Mutex
+}
+
+// newRemoteJWKS creates a remote key set, call refresh to load it
+func newRemoteJWKS(url string) *remoteJWKS {
+	return &remoteJWKS{
+		url:    url,
+		client: &http.Client{Timeout: jwksFetchTimeout},
+		keys:   make(map[string]*Key),
+	}
+}
+
+// get returns the key with the given kid, refreshing the set at most once per jwksRefreshInterval
+func (r *remoteJWKS) get(kid string) *Key {
+	r.mu.RLock()
+	key, ok := r.keys[kid]
+	stale := time.Since(r.fetchedAt) > jwksRefreshInterval
+	r.mu.RUnlock()
+
+	if ok || !stale {
+		return key
+	}
+
+	r.refreshMu.Lock()
+	defer r.refreshMu.Unlock()
+
+	// another caller may have refreshed while this one waited
+	r.mu.RLock()
+	key, ok = r.keys[kid]
+	stale = time.Since(r.fetchedAt) > jwksRefreshInterval
+	r.mu.RUnlock()
+	if ok || !stale {
+		return key
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), jwksFetchTimeout)
+	defer cancel()
+	if err := r.refresh(ctx); err != nil {
+		return nil
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.keys[kid]
+}
+
+// refresh downloads and replaces the key set
+func (r *remoteJWKS) refresh(ctx context.Context) error {
+	r.mu.Lock()
+	// mark the attempt first so a failing endpoint is not hammered
+	r.fetchedAt = time.Now()
+	r.mu.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create JWKS request: %w", err)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch JWKS: unexpected status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxJWKSSize+1))
+	if err != nil {
+		return fmt.Errorf("failed to read JWKS: %w", err)
+	}
+	if len(data) > maxJWKSSize {
+		return fmt.Errorf("failed to read JWKS: document exceeds %d bytes", maxJWKSSize)
+	}
+
+	keys, err := ParseJWKS(data)
+	if err != nil {
+		return err
+	}
+
+	set := make(map[string]*Key, len(keys))
+	for _, key := range keys {
+		set[key.ID] = key
+	}
+
+	r.mu.Lock()
+	r.keys = set
+	r.mu.Unlock()
+	return nil
+}
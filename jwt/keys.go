@@ -0,0 +1,170 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Supported signing algorithms
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgEdDSA = "EdDSA"
+)
+
+var (
+	// ErrNoSigningKey is returned when a verification only manager is asked to sign a token
+	ErrNoSigningKey = errors.New("no signing key configured")
+	// ErrUnsupportedKey is returned for key types other than RSA, ECDSA P-256 and Ed25519
+	ErrUnsupportedKey = errors.New("unsupported key type")
+)
+
+// Key is a signing or verification key identified by its kid
+type Key struct {
+	ID        string
+	Algorithm string
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// NewHMACKey creates a HS256 key from a shared secret
+func NewHMACKey(kid string, secret []byte) *Key {
+	return &Key{ID: kid, Algorithm: AlgHS256, signKey: secret, verifyKey: secret}
+}
+
+// NewSigningKey creates a signing key from an RSA (RS256), ECDSA P-256 (ES256) or Ed25519 (EdDSA) private key.
+// An empty kid defaults to the RFC 7638 thumbprint of the public key.
+func NewSigningKey(kid string, private crypto.Signer) (*Key, error) {
+	key, err := NewVerificationKey(kid, private.Public())
+	if err != nil {
+		return nil, err
+	}
+	key.signKey = private
+	return key, nil
+}
+
+// NewVerificationKey creates a verification only key from a public key.
+// An empty kid defaults to the RFC 7638 thumbprint of the public key.
+func NewVerificationKey(kid string, public crypto.PublicKey) (*Key, error) {
+	alg, err := algorithmFor(public)
+	if err != nil {
+		return nil, err
+	}
+
+	if kid == "" {
+		if kid, err = thumbprint(public); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Key{ID: kid, Algorithm: alg, verifyKey: public}, nil
+}
+
+// ParseKeyPEM parses a PEM encoded private key (PKCS#1, PKCS#8, SEC 1) or public key (PKIX, PKCS#1)
+func ParseKeyPEM(kid string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		private, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse RSA private key: %w", err)
+		}
+		return NewSigningKey(kid, private)
+
+	case "EC PRIVATE KEY":
+		private, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse EC private key: %w", err)
+		}
+		return NewSigningKey(kid, private)
+
+	case "PRIVATE KEY":
+		private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse PKCS#8 private key: %w", err)
+		}
+		signer, ok := private.(crypto.Signer)
+		if !ok {
+			return nil, ErrUnsupportedKey
+		}
+		return NewSigningKey(kid, signer)
+
+	case "RSA PUBLIC KEY":
+		public, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse RSA public key: %w", err)
+		}
+		return NewVerificationKey(kid, public)
+
+	case "PUBLIC KEY":
+		public, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public key: %w", err)
+		}
+		return NewVerificationKey(kid, public)
+
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+}
+
+// LoadKeyFile reads and parses a PEM key file
+func LoadKeyFile(kid, path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+
+	key, err := ParseKeyPEM(kid, data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return key, nil
+}
+
+// CanSign reports whether the key holds private material
+func (k *Key) CanSign() bool {
+	return k.signKey != nil
+}
+
+// IsAsymmetric reports whether the key can be published in a JWKS document
+func (k *Key) IsAsymmetric() bool {
+	return k.Algorithm != AlgHS256
+}
+
+// method returns the jwt signing method of the key
+func (k *Key) method() jwt.SigningMethod {
+	return jwt.GetSigningMethod(k.Algorithm)
+}
+
+// algorithmFor maps a public key type to its signing algorithm
+func algorithmFor(public crypto.PublicKey) (string, error) {
+	switch k := public.(type) {
+	case *rsa.PublicKey:
+		return AlgRS256, nil
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return "", fmt.Errorf("%w: only the P-256 curve is supported", ErrUnsupportedKey)
+		}
+		return AlgES256, nil
+	case ed25519.PublicKey:
+		return AlgEdDSA, nil
+	default:
+		return "", fmt.Errorf("%w: %T", ErrUnsupportedKey, public)
+	}
+}
@@ -0,0 +1,114 @@
+package jwt_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cozy-hub-app/framework/jwt"
+)
+
+func newSigner(t *testing.T, alg string) crypto.Signer {
+	t.Helper()
+	var (
+		signer crypto.Signer
+		err    error
+	)
+	switch alg {
+	case jwt.AlgRS256:
+		signer, err = rsa.GenerateKey(rand.Reader, 2048)
+	case jwt.AlgES256:
+		signer, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case jwt.AlgEdDSA:
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	}
+	require.NoError(t, err)
+	return signer
+}
+
+func TestAsymmetricSigning(t *testing.T) {
+	for _, alg := range []string{jwt.AlgRS256, jwt.AlgES256, jwt.AlgEdDSA} {
+		t.Run("Should sign and verify with "+alg, func(t *testing.T) {
+			key, err := jwt.NewSigningKey("", newSigner(t, alg))
+			require.NoError(t, err)
+			assert.Equal(t, alg, key.Algorithm)
+			assert.NotEmpty(t, key.ID)
+
+			m := jwt.NewJWTManagerWithKey(key, time.Minute, time.Hour, "test")
+			token, err := m.GenerateAccessToken("user-1", "user@example.com")
+			require.NoError(t, err)
+
+			claims, err := m.ValidateToken(token)
+			require.NoError(t, err)
+			assert.Equal(t, "user-1", claims.UserID)
+
+			// a verifier holding only the published JWKS accepts the token
+			doc, err := json.Marshal(m.JWKS())
+			require.NoError(t, err)
+			keys, err := jwt.ParseJWKS(doc)
+			require.NoError(t, err)
+			require.Len(t, keys, 1)
+			assert.False(t, keys[0].CanSign())
+
+			verifier := jwt.NewJWTManagerWithKey(nil, time.Minute, time.Hour, "test").WithVerificationKeys(keys...)
+			claims, err = verifier.ValidateToken(token)
+			require.NoError(t, err)
+			assert.Equal(t, "user-1", claims.UserID)
+
+			_, err = verifier.GenerateAccessToken("user-1", "user@example.com")
+			assert.ErrorIs(t, err, jwt.ErrNoSigningKey)
+		})
+	}
+}
+
+func TestRotateSigningKey(t *testing.T) {
+	oldKey, err := jwt.NewSigningKey("old", newSigner(t, jwt.AlgES256))
+	require.NoError(t, err)
+	newKey, err := jwt.NewSigningKey("new", newSigner(t, jwt.AlgEdDSA))
+	require.NoError(t, err)
+
+	m := jwt.NewJWTManagerWithKey(oldKey, time.Minute, time.Hour, "test")
+	oldToken, err := m.GenerateAccessToken("user-1", "user@example.com")
+	require.NoError(t, err)
+
+	require.NoError(t, m.RotateSigningKey(newKey))
+	assert.Equal(t, "new", m.SigningKeyID())
+
+	newToken, err := m.GenerateAccessToken("user-1", "user@example.com")
+	require.NoError(t, err)
+
+	_, err = m.ValidateToken(oldToken)
+	require.NoError(t, err, "Should accept tokens signed before the rotation")
+	_, err = m.ValidateToken(newToken)
+	require.NoError(t, err)
+
+	jwks := m.JWKS()
+	require.Len(t, jwks.Keys, 2)
+	assert.Equal(t, "new", jwks.Keys[0].Kid, "Should list the current key first")
+
+	m.RemoveKey("old")
+	_, err = m.ValidateToken(oldToken)
+	assert.ErrorIs(t, err, jwt.ErrInvalidToken)
+}
+
+func TestHMACTokenRejectedByAsymmetricKey(t *testing.T) {
+	hmac := jwt.NewJWTManager(testSecret, time.Minute, time.Hour, "test")
+	token, err := hmac.GenerateAccessToken("user-1", "user@example.com")
+	require.NoError(t, err)
+
+	key, err := jwt.NewSigningKey("", newSigner(t, jwt.AlgRS256))
+	require.NoError(t, err)
+	m := jwt.NewJWTManagerWithKey(key, time.Minute, time.Hour, "test")
+
+	_, err = m.ValidateToken(token)
+	assert.ErrorIs(t, err, jwt.ErrInvalidToken)
+}
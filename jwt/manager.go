@@ -1,11 +1,16 @@
 package jwt
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"sort"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"github.com/cozy-hub-app/framework/env"
 )
 
@@ -16,22 +21,55 @@ var (
 	ErrExpiredToken = errors.New("token has expired")
 	// ErrTokenNotValidYet is returned when token is not yet valid
 	ErrTokenNotValidYet = errors.New("token not valid yet")
+	// ErrWrongTokenType is returned when a refresh token is used as access token or vice versa
+	ErrWrongTokenType = errors.New("wrong token type")
+	// ErrRevokedToken is returned when the token or its family has been revoked
+	ErrRevokedToken = errors.New("token has been revoked")
+	// ErrTokenReused is returned when a consumed refresh token is presented again,
+	// the whole token family is revoked
+	ErrTokenReused = errors.New("refresh token reused")
 )
 
+// Token types
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+)
+
+// RoleAdmin is the role of admin users
+const RoleAdmin = "admin"
+
 // JWTClaims defines the structure of JWT token claims
 type JWTClaims struct {
 	UserID string `json:"user_id"`
 	Email  string `json:"email"`
 	Role   string `json:"role,omitempty"` // "admin" for admin users, empty for regular users
+	// TokenType is "access" or "refresh", empty for tokens issued before token types existed
+	TokenType string `json:"token_type,omitempty"`
+	// FamilyID is shared by every token descending from the same login
+	FamilyID  string   `json:"family_id,omitempty"`
+	TenantID  string   `json:"tenant_id,omitempty"`
+	SessionID string   `json:"session_id,omitempty"`
+	Scopes    []string `json:"scopes,omitempty"`
+	// Custom holds service specific claims, see SetCustomClaims and CustomClaims
+	Custom json.RawMessage `json:"ext,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// JWTManager handles JWT token generation and validation
+// JWTManager handles JWT token generation and validation.
+// Tokens are signed with the current signing key, every registered key stays valid for verification
+// so tokens issued before a rotation keep working until they expire.
 type JWTManager struct {
-	secretKey       string
+	mu              sync.RWMutex
+	signingKey      *Key
+	keys            map[string]*Key
+	remote          *remoteJWKS
+	store           Store
 	accessTokenTTL  time.Duration
 	refreshTokenTTL time.Duration
 	issuer          string
+	audience        []string
+	leeway          time.Duration
 }
 
 var (
@@ -39,39 +77,31 @@ var (
 	jwtManagerOnce     sync.Once
 )
 
-// NewJWTManager creates a new JWT manager
+// NewJWTManager creates a new HS256 JWT manager
 func NewJWTManager(secretKey string, accessTokenTTL, refreshTokenTTL time.Duration, issuer string) *JWTManager {
-	return &JWTManager{
-		secretKey:       secretKey,
+	return NewJWTManagerWithKey(NewHMACKey("", []byte(secretKey)), accessTokenTTL, refreshTokenTTL, issuer)
+}
+
+// NewJWTManagerWithKey creates a JWT manager signing with the given key.
+// A nil key creates a verification only manager, see WithVerificationKeys and WithJWKSURL.
+func NewJWTManagerWithKey(signingKey *Key, accessTokenTTL, refreshTokenTTL time.Duration, issuer string) *JWTManager {
+	m := &JWTManager{
+		keys:            make(map[string]*Key),
 		accessTokenTTL:  accessTokenTTL,
 		refreshTokenTTL: refreshTokenTTL,
 		issuer:          issuer,
 	}
+	if signingKey != nil {
+		m.signingKey = signingKey
+		m.keys[signingKey.ID] = signingKey
+	}
+	return m
 }
 
 // GetJWTManager returns the singleton JWT manager instance
 // This is initialized once from environment variables
 func GetJWTManager() *JWTManager {
 	jwtManagerOnce.Do(func() {
-		// Get JWT config from environment
-		secretKey := env.Get(env.JWTSecretKey)
-
-		// CRITICAL SECURITY: JWT secret MUST be set and strong
-		// A weak or missing secret allows anyone to forge authentication tokens
-		if secretKey == "" {
-			panic("FATAL: JWT_SECRET_KEY environment variable is not set. " +
-				"This is a critical security requirement. " +
-				"Generate a secure key with: openssl rand -base64 64")
-		}
-
-		// Enforce minimum key length (64 characters = ~384 bits of entropy)
-		// Industry standard for HMAC-SHA256 is at least 256 bits
-		if len(secretKey) < 64 {
-			panic("FATAL: JWT_SECRET_KEY must be at least 64 characters long for security. " +
-				"Current length: " + string(rune(len(secretKey))) + ". " +
-				"Generate a secure key with: openssl rand -base64 64")
-		}
-
 		// Parse TTL durations
 		accessTTL := parseDuration(env.Get(env.JWTAccessTokenTTL), 15*time.Minute)
 		refreshTTL := parseDuration(env.Get(env.JWTRefreshTokenTTL), 168*time.Hour)
@@ -81,70 +111,275 @@ func GetJWTManager() *JWTManager {
 			issuer = "cozy-hub-service"
 		}
 
-		jwtManagerInstance = NewJWTManager(secretKey, accessTTL, refreshTTL, issuer)
+		signingKey := signingKeyFromEnv()
+		m := NewJWTManagerWithKey(signingKey, accessTTL, refreshTTL, issuer).
+			WithAudience(env.GetList(env.JWTAudience)...).
+			WithLeeway(parseDuration(env.Get(env.JWTLeeway), 0))
+
+		// Tokens signed with a previous key (or by another service) stay verifiable
+		for _, path := range env.GetList(env.JWTVerificationKeyFiles) {
+			key, err := LoadKeyFile("", path)
+			if err != nil {
+				panic("FATAL: invalid JWT verification key: " + err.Error())
+			}
+			m.WithVerificationKeys(key)
+		}
+
+		// Keep legacy HS256 tokens valid while migrating to an asymmetric key
+		if secretKey := env.Get(env.JWTSecretKey); secretKey != "" && signingKey != nil && signingKey.IsAsymmetric() {
+			m.WithVerificationKeys(NewHMACKey("", []byte(secretKey)))
+		}
+
+		if url := env.Get(env.JWTJWKSURL); url != "" {
+			if _, err := m.WithJWKSURL(context.Background(), url); err != nil {
+				panic("FATAL: " + err.Error())
+			}
+		}
+
+		if signingKey == nil && len(m.keys) == 0 && m.remote == nil {
+			panic("FATAL: JWT_SECRET_KEY environment variable is not set. " +
+				"This is a critical security requirement. " +
+				"Generate a secure key with: openssl rand -base64 64, " +
+				"or configure JWT_PRIVATE_KEY_FILE, JWT_VERIFICATION_KEY_FILES or JWT_JWKS_URL")
+		}
+
+		jwtManagerInstance = m
 	})
 
 	return jwtManagerInstance
 }
 
-// GenerateAccessToken generates an access token for regular users
-func (m *JWTManager) GenerateAccessToken(userID, email string) (string, error) {
-	return m.generateToken(userID, email, m.accessTokenTTL)
+// signingKeyFromEnv loads the signing key from JWT_PRIVATE_KEY_FILE or JWT_SECRET_KEY,
+// nil when neither is set (verification only)
+func signingKeyFromEnv() *Key {
+	kid := env.Get(env.JWTKeyID)
+	alg := env.Get(env.JWTAlgorithm)
+
+	if path := env.Get(env.JWTPrivateKeyFile); path != "" {
+		key, err := LoadKeyFile(kid, path)
+		if err != nil {
+			panic("FATAL: invalid JWT private key: " + err.Error())
+		}
+		if !key.CanSign() {
+			panic("FATAL: JWT_PRIVATE_KEY_FILE must contain a private key")
+		}
+		if alg != "" && alg != key.Algorithm {
+			panic("FATAL: JWT_ALGORITHM " + alg + " does not match the " + key.Algorithm + " private key")
+		}
+		return key
+	}
+
+	// Get JWT config from environment
+	secretKey := env.Get(env.JWTSecretKey)
+	if secretKey == "" {
+		return nil
+	}
+
+	if alg != "" && alg != AlgHS256 {
+		panic("FATAL: JWT_ALGORITHM " + alg + " requires JWT_PRIVATE_KEY_FILE")
+	}
+
+	// CRITICAL SECURITY: JWT secret MUST be strong
+	// A weak secret allows anyone to forge authentication tokens
+	// Enforce minimum key length (64 characters = ~384 bits of entropy)
+	// Industry standard for HMAC-SHA256 is at least 256 bits
+	if len(secretKey) < 64 {
+		panic("FATAL: JWT_SECRET_KEY must be at least 64 characters long for security. " +
+			"Current length: " + strconv.Itoa(len(secretKey)) + ". " +
+			"Generate a secure key with: openssl rand -base64 64")
+	}
+
+	return NewHMACKey(kid, []byte(secretKey))
 }
 
-// GenerateRefreshToken generates a refresh token for regular users
-func (m *JWTManager) GenerateRefreshToken(userID, email string) (string, error) {
-	return m.generateToken(userID, email, m.refreshTokenTTL)
+// WithVerificationKeys registers keys accepted for verification only
+func (m *JWTManager) WithVerificationKeys(keys ...*Key) *JWTManager {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, key := range keys {
+		m.keys[key.ID] = key
+	}
+	return m
 }
 
-// generateToken is the internal token generation method
-func (m *JWTManager) generateToken(userID, email string, ttl time.Duration) (string, error) {
-	return m.generateTokenWithRole(userID, email, "", ttl)
+// WithJWKSURL verifies tokens with the keys published by another service.
+// The document is fetched once here and again when a token carries an unknown kid.
+func (m *JWTManager) WithJWKSURL(ctx context.Context, url string) (*JWTManager, error) {
+	remote := newRemoteJWKS(url)
+	if err := remote.refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	m.remote = remote
+	m.mu.Unlock()
+	return m, nil
 }
 
-// generateTokenWithRole generates a token with an optional role
-func (m *JWTManager) generateTokenWithRole(userID, email, role string, ttl time.Duration) (string, error) {
-	now := time.Now()
-	expiresAt := now.Add(ttl)
+// RotateSigningKey makes key the current signing key, the previous keys stay valid for verification
+func (m *JWTManager) RotateSigningKey(key *Key) error {
+	if !key.CanSign() {
+		return ErrNoSigningKey
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.signingKey = key
+	m.keys[key.ID] = key
+	return nil
+}
+
+// RemoveKey stops accepting tokens signed with kid, the current signing key cannot be removed
+func (m *JWTManager) RemoveKey(kid string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.signingKey != nil && m.signingKey.ID == kid {
+		return
+	}
+	delete(m.keys, kid)
+}
+
+// SigningKeyID returns the kid of the current signing key
+func (m *JWTManager) SigningKeyID() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.signingKey == nil {
+		return ""
+	}
+	return m.signingKey.ID
+}
+
+// JWKS returns the public keys of the manager, HMAC keys are never published
+func (m *JWTManager) JWKS() JWKS {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	set := JWKS{Keys: make([]JWK, 0, len(m.keys))}
+	for _, key := range m.keys {
+		if jwk, ok := key.JWK(); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	// stable output, current signing key first
+	sort.Slice(set.Keys, func(i, j int) bool {
+		if m.signingKey != nil && (set.Keys[i].Kid == m.signingKey.ID) != (set.Keys[j].Kid == m.signingKey.ID) {
+			return set.Keys[i].Kid == m.signingKey.ID
+		}
+		return set.Keys[i].Kid < set.Keys[j].Kid
+	})
+
+	return set
+}
+
+// lookupKey returns the verification key of kid
+func (m *JWTManager) lookupKey(kid string) *Key {
+	m.mu.RLock()
+	key, ok := m.keys[kid]
+	remote := m.remote
+	m.mu.RUnlock()
 
-	claims := JWTClaims{
-		UserID: userID,
-		Email:  email,
-		Role:   role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expiresAt),
-			IssuedAt:  jwt.NewNumericDate(now),
-			NotBefore: jwt.NewNumericDate(now),
-			Issuer:    m.issuer,
-		},
+	if ok {
+		return key
 	}
+	if remote != nil {
+		return remote.get(kid)
+	}
+	return nil
+}
+
+// GenerateAccessToken generates an access token for regular users
+func (m *JWTManager) GenerateAccessToken(userID, email string) (string, error) {
+	return m.generateToken(JWTClaims{UserID: userID, Email: email}, TokenTypeAccess, uuid.NewString())
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(m.secretKey))
+// GenerateRefreshToken generates a refresh token for regular users, starting a new token family
+func (m *JWTManager) GenerateRefreshToken(userID, email string) (string, error) {
+	return m.generateToken(JWTClaims{UserID: userID, Email: email}, TokenTypeRefresh, uuid.NewString())
 }
 
 // GenerateAdminAccessToken generates an access token with admin role
 func (m *JWTManager) GenerateAdminAccessToken(userID, email string) (string, error) {
-	return m.generateTokenWithRole(userID, email, "admin", m.accessTokenTTL)
+	return m.generateToken(JWTClaims{UserID: userID, Email: email, Role: RoleAdmin}, TokenTypeAccess, uuid.NewString())
 }
 
-// GenerateAdminRefreshToken generates a refresh token with admin role
+// GenerateAdminRefreshToken generates a refresh token with admin role, starting a new token family
 func (m *JWTManager) GenerateAdminRefreshToken(userID, email string) (string, error) {
-	return m.generateTokenWithRole(userID, email, "admin", m.refreshTokenTTL)
+	return m.generateToken(JWTClaims{UserID: userID, Email: email, Role: RoleAdmin}, TokenTypeRefresh, uuid.NewString())
+}
+
+// GenerateTokenPair generates an access and refresh token pair sharing a new token family
+func (m *JWTManager) GenerateTokenPair(userID, email, role string) (accessToken string, refreshToken string, err error) {
+	return m.IssueTokenPair(JWTClaims{UserID: userID, Email: email, Role: role})
+}
+
+// generatePair generates an access and refresh token pair in the given family
+func (m *JWTManager) generatePair(template JWTClaims, familyID string) (string, string, error) {
+	accessToken, err := m.generateToken(template, TokenTypeAccess, familyID)
+	if err != nil {
+		return "", "", err
+	}
+
+	refreshToken, err := m.generateToken(template, TokenTypeRefresh, familyID)
+	if err != nil {
+		return "", "", err
+	}
+
+	return accessToken, refreshToken, nil
+}
+
+// generateToken is the internal token generation method.
+// Identity and custom claims are copied from template, every token gets a unique jti.
+// The subject defaults to the user ID and the audience to the manager audience.
+func (m *JWTManager) generateToken(template JWTClaims, tokenType, familyID string) (string, error) {
+	ttl := m.accessTokenTTL
+	if tokenType == TokenTypeRefresh {
+		ttl = m.refreshTokenTTL
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+
+	claims := template
+	claims.TokenType = tokenType
+	claims.FamilyID = familyID
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ID:        uuid.NewString(),
+		Subject:   template.Subject,
+		Audience:  template.Audience,
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
+		Issuer:    m.issuer,
+	}
+	if claims.Subject == "" {
+		claims.Subject = claims.UserID
+	}
+	if len(claims.Audience) == 0 && len(m.audience) > 0 {
+		claims.Audience = m.audience
+	}
+
+	m.mu.RLock()
+	key := m.signingKey
+	m.mu.RUnlock()
+	if key == nil {
+		return "", ErrNoSigningKey
+	}
+
+	token := jwt.NewWithClaims(key.method(), claims)
+	if key.ID != "" {
+		token.Header["kid"] = key.ID
+	}
+	return token.SignedString(key.signKey)
 }
 
-// ValidateToken validates a JWT token and returns the claims
+// ValidateToken validates the signature and lifetime of a JWT token and returns the claims.
+// It does not check the token type nor the revocation store, see ValidateAccessToken.
 func (m *JWTManager) ValidateToken(tokenString string) (*JWTClaims, error) {
 	token, err := jwt.ParseWithClaims(
 		tokenString,
 		&JWTClaims{},
-		func(token *jwt.Token) (interface{}, error) {
-			// Verify the signing method
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, ErrInvalidToken
-			}
-			return []byte(m.secretKey), nil
-		},
+		m.keyFunc,
+		m.parserOptions()...,
 	)
 
 	if err != nil {
@@ -166,14 +401,42 @@ func (m *JWTManager) ValidateToken(tokenString string) (*JWTClaims, error) {
 	return claims, nil
 }
 
-// RefreshAccessToken validates a refresh token and generates a new access token
+// parserOptions returns the issuer, audience and leeway validation options
+func (m *JWTManager) parserOptions() []jwt.ParserOption {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	opts := []jwt.ParserOption{jwt.WithExpirationRequired(), jwt.WithLeeway(m.leeway)}
+	if m.issuer != "" {
+		opts = append(opts, jwt.WithIssuer(m.issuer))
+	}
+	if len(m.audience) > 0 {
+		opts = append(opts, jwt.WithAudience(m.audience...))
+	}
+	return opts
+}
+
+// keyFunc selects the verification key from the kid header.
+// The token algorithm must match the key to prevent algorithm confusion.
+func (m *JWTManager) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key := m.lookupKey(kid)
+	if key == nil || token.Method.Alg() != key.Algorithm {
+		return nil, ErrInvalidToken
+	}
+	return key.verifyKey, nil
+}
+
+// RefreshAccessToken validates a refresh token and generates a new access token.
+// Deprecated: use Refresh, which rotates the refresh token and detects reuse.
 func (m *JWTManager) RefreshAccessToken(refreshToken string) (string, error) {
-	claims, err := m.ValidateToken(refreshToken)
+	ctx := context.Background()
+	claims, err := m.validate(ctx, refreshToken, TokenTypeRefresh)
 	if err != nil {
 		return "", err
 	}
 
-	return m.GenerateAccessToken(claims.UserID, claims.Email)
+	return m.generateToken(*claims, TokenTypeAccess, claims.FamilyID)
 }
 
 // GetUserIDFromToken extracts the user ID from a token without full validation
@@ -188,36 +451,12 @@ func (m *JWTManager) GetUserIDFromToken(tokenString string) (string, error) {
 
 // GenerateTokenPair generates a pair of access and refresh tokens for regular users
 func GenerateTokenPair(userID, email string) (accessToken string, refreshToken string, err error) {
-	jwtManager := GetJWTManager()
-
-	accessToken, err = jwtManager.GenerateAccessToken(userID, email)
-	if err != nil {
-		return "", "", err
-	}
-
-	refreshToken, err = jwtManager.GenerateRefreshToken(userID, email)
-	if err != nil {
-		return "", "", err
-	}
-
-	return accessToken, refreshToken, nil
+	return GetJWTManager().GenerateTokenPair(userID, email, "")
 }
 
 // GenerateAdminTokenPair generates a pair of access and refresh tokens with admin role
 func GenerateAdminTokenPair(userID, email string) (accessToken string, refreshToken string, err error) {
-	jwtManager := GetJWTManager()
-
-	accessToken, err = jwtManager.GenerateAdminAccessToken(userID, email)
-	if err != nil {
-		return "", "", err
-	}
-
-	refreshToken, err = jwtManager.GenerateAdminRefreshToken(userID, email)
-	if err != nil {
-		return "", "", err
-	}
-
-	return accessToken, refreshToken, nil
+	return GetJWTManager().GenerateTokenPair(userID, email, RoleAdmin)
 }
 
 // parseDuration parses a duration string, returns defaultDuration if parsing fails
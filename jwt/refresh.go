@@ -0,0 +1,130 @@
+package jwt
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNoStore is returned when revocation is requested on a manager without a Store
+var ErrNoStore = errors.New("no revocation store configured")
+
+// WithStore enables revocation and refresh token reuse detection
+func (m *JWTManager) WithStore(store Store) *JWTManager {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.store = store
+	return m
+}
+
+// ValidateAccessToken validates an access token and checks it against the revocation store.
+// Tokens issued without a token type are accepted until they expire.
+func (m *JWTManager) ValidateAccessToken(ctx context.Context, tokenString string) (*JWTClaims, error) {
+	return m.validate(ctx, tokenString, TokenTypeAccess)
+}
+
+// Refresh consumes a refresh token and issues a new token pair in the same family.
+// Presenting an already consumed refresh token revokes the whole family and returns ErrTokenReused.
+// Without a Store the pair is rotated but reuse cannot be detected.
+func (m *JWTManager) Refresh(ctx context.Context, refreshToken string) (accessToken string, newRefreshToken string, err error) {
+	claims, err := m.validate(ctx, refreshToken, TokenTypeRefresh)
+	if err != nil {
+		return "", "", err
+	}
+
+	if store := m.getStore(); store != nil {
+		first, err := store.Consume(ctx, claims.ID, claims.ExpiresAt.Time)
+		if err != nil {
+			return "", "", err
+		}
+		if !first {
+			if err := m.RevokeFamily(ctx, claims.FamilyID); err != nil {
+				return "", "", err
+			}
+			return "", "", ErrTokenReused
+		}
+	}
+
+	return m.generatePair(*claims, claims.FamilyID)
+}
+
+// Revoke denylists a single token until it expires, already expired tokens are ignored
+func (m *JWTManager) Revoke(ctx context.Context, tokenString string) error {
+	store := m.getStore()
+	if store == nil {
+		return ErrNoStore
+	}
+
+	claims, err := m.ValidateToken(tokenString)
+	if errors.Is(err, ErrExpiredToken) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if claims.ID == "" {
+		return ErrInvalidToken
+	}
+
+	return store.Revoke(ctx, claims.ID, claims.ExpiresAt.Time)
+}
+
+// RevokeFamily revokes every access and refresh token descending from the same login, e.g. on logout
+func (m *JWTManager) RevokeFamily(ctx context.Context, familyID string) error {
+	store := m.getStore()
+	if store == nil {
+		return ErrNoStore
+	}
+	if familyID == "" {
+		return ErrInvalidToken
+	}
+
+	// no token of the family can outlive a refresh token issued now
+	return store.Revoke(ctx, familyID, time.Now().Add(m.refreshTokenTTL))
+}
+
+// validate checks the signature, the token type and the revocation store
+func (m *JWTManager) validate(ctx context.Context, tokenString, tokenType string) (*JWTClaims, error) {
+	claims, err := m.ValidateToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	// legacy untyped tokens are only accepted as access tokens
+	if claims.TokenType != tokenType && (tokenType != TokenTypeAccess || claims.TokenType != "") {
+		return nil, ErrWrongTokenType
+	}
+
+	store := m.getStore()
+	if store == nil {
+		return claims, nil
+	}
+
+	ids := make([]string, 0, 2)
+	if claims.ID != "" {
+		ids = append(ids, claims.ID)
+	}
+	if claims.FamilyID != "" {
+		ids = append(ids, claims.FamilyID)
+	}
+	if len(ids) == 0 {
+		return claims, nil
+	}
+
+	revoked, err := store.IsRevoked(ctx, ids...)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrRevokedToken
+	}
+
+	return claims, nil
+}
+
+// getStore returns the configured store, nil when revocation is disabled
+func (m *JWTManager) getStore() Store {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.store
+}
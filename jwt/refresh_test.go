@@ -0,0 +1,64 @@
+package jwt_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cozy-hub-app/framework/jwt"
+)
+
+const testSecret = "secret-secret-secret-secret-secret-secret-secret-secret-secret-secret"
+
+func TestRefreshRotation(t *testing.T) {
+	ctx := context.Background()
+	m := jwt.NewJWTManager(testSecret, time.Minute, time.Hour, "test").WithStore(jwt.NewMemoryStore())
+
+	access, refresh, err := m.GenerateTokenPair("user-1", "user@example.com", jwt.RoleAdmin)
+	require.NoError(t, err)
+
+	_, _, err = m.Refresh(ctx, access)
+	assert.ErrorIs(t, err, jwt.ErrWrongTokenType, "Should reject an access token as refresh token")
+	_, err = m.ValidateAccessToken(ctx, refresh)
+	assert.ErrorIs(t, err, jwt.ErrWrongTokenType, "Should reject a refresh token as access token")
+
+	newAccess, newRefresh, err := m.Refresh(ctx, refresh)
+	require.NoError(t, err)
+
+	claims, err := m.ValidateAccessToken(ctx, newAccess)
+	require.NoError(t, err)
+	assert.Equal(t, jwt.RoleAdmin, claims.Role)
+	assert.NotEmpty(t, claims.ID)
+
+	// replaying the consumed refresh token kills the whole family
+	_, _, err = m.Refresh(ctx, refresh)
+	assert.ErrorIs(t, err, jwt.ErrTokenReused)
+
+	_, _, err = m.Refresh(ctx, newRefresh)
+	assert.ErrorIs(t, err, jwt.ErrRevokedToken)
+	_, err = m.ValidateAccessToken(ctx, newAccess)
+	assert.ErrorIs(t, err, jwt.ErrRevokedToken)
+}
+
+func TestRevoke(t *testing.T) {
+	ctx := context.Background()
+	m := jwt.NewJWTManager(testSecret, time.Minute, time.Hour, "test")
+
+	access, _, err := m.GenerateTokenPair("user-1", "user@example.com", "")
+	require.NoError(t, err)
+	assert.ErrorIs(t, m.Revoke(ctx, access), jwt.ErrNoStore)
+
+	m.WithStore(jwt.NewMemoryStore())
+	other, _, err := m.GenerateTokenPair("user-1", "user@example.com", "")
+	require.NoError(t, err)
+
+	require.NoError(t, m.Revoke(ctx, access))
+	_, err = m.ValidateAccessToken(ctx, access)
+	assert.ErrorIs(t, err, jwt.ErrRevokedToken)
+
+	_, err = m.ValidateAccessToken(ctx, other)
+	assert.NoError(t, err, "Should only revoke the given token")
+}
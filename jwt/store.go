@@ -0,0 +1,94 @@
+package jwt
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// memoryPurgeInterval bounds how often expired entries are swept from the memory store
+const memoryPurgeInterval = time.Minute
+
+// Store persists revoked token ids and consumed refresh tokens.
+// Token ids (jti) and family ids share the revocation namespace.
+type Store interface {
+	// Revoke denylists a token or family id until expiresAt
+	Revoke(ctx context.Context, id string, expiresAt time.Time) error
+	// IsRevoked reports whether any of the ids is denylisted
+	IsRevoked(ctx context.Context, ids ...string) (bool, error)
+	// Consume marks a refresh token id as used, false when it was already consumed
+	Consume(ctx context.Context, jti string, expiresAt time.Time) (bool, error)
+}
+
+// MemoryStore is a per-process Store, suitable for a single instance or tests
+type MemoryStore struct {
+	mu        sync.Mutex
+	revoked   map[string]time.Time
+	consumed  map[string]time.Time
+	lastPurge time.Time
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		revoked:   make(map[string]time.Time),
+		consumed:  make(map[string]time.Time),
+		lastPurge: time.Now(),
+	}
+}
+
+// Revoke denylists id until expiresAt
+func (s *MemoryStore) Revoke(_ context.Context, id string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.purge()
+	if current, ok := s.revoked[id]; !ok || expiresAt.After(current) {
+		s.revoked[id] = expiresAt
+	}
+	return nil
+}
+
+// IsRevoked reports whether any of the ids is denylisted
+func (s *MemoryStore) IsRevoked(_ context.Context, ids ...string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for _, id := range ids {
+		if expiresAt, ok := s.revoked[id]; ok && now.Before(expiresAt) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Consume marks jti as used, false when it was already consumed
+func (s *MemoryStore) Consume(_ context.Context, jti string, expiresAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.purge()
+	if current, ok := s.consumed[jti]; ok && time.Now().Before(current) {
+		return false, nil
+	}
+	s.consumed[jti] = expiresAt
+	return true, nil
+}
+
+// purge drops expired entries, the caller must hold the lock
+func (s *MemoryStore) purge() {
+	now := time.Now()
+	if now.Sub(s.lastPurge) < memoryPurgeInterval {
+		return
+	}
+	s.lastPurge = now
+
+	for id, expiresAt := range s.revoked {
+		if now.After(expiresAt) {
+			delete(s.revoked, id)
+		}
+	}
+	for id, expiresAt := range s.consumed {
+		if now.After(expiresAt) {
+			delete(s.consumed, id)
+		}
+	}
+}
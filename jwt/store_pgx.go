@@ -0,0 +1,108 @@
+package jwt
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	pgxv5 "github.com/jackc/pgx/v5"
+
+	"github.com/cozy-hub-app/framework/pgx"
+)
+
+// DefaultStoreTable is the table used by PgxStore
+const DefaultStoreTable = "jwt_revocations"
+
+// entry kinds of the revocation table
+const (
+	kindRevoked  = "revoked"
+	kindConsumed = "consumed"
+)
+
+// PgxStore is a Store shared by every instance through Postgres.
+// Queries always go to the primary so a revocation is visible immediately.
+type PgxStore struct {
+	ds    *pgx.DataSource
+	table string
+}
+
+// NewPgxStore creates a Postgres store on ds, call Migrate once to create its table
+func NewPgxStore(ds *pgx.DataSource) *PgxStore {
+	return &PgxStore{ds: ds, table: DefaultStoreTable}
+}
+
+// WithTable overrides the revocation table name
+func (s *PgxStore) WithTable(table string) *PgxStore {
+	s.table = table
+	return s
+}
+
+// Migrate creates the revocation table if it does not exist
+func (s *PgxStore) Migrate(ctx context.Context) error {
+	table := s.ident()
+	_, err := s.ds.Querier(ctx).Exec(ctx, fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			kind       TEXT        NOT NULL,
+			id         TEXT        NOT NULL,
+			expires_at TIMESTAMPTZ NOT NULL,
+			PRIMARY KEY (kind, id)
+		);
+		CREATE INDEX IF NOT EXISTS %s ON %s (expires_at)`,
+		table, pgxv5.Identifier{s.table + "_expires_at_idx"}.Sanitize(), table))
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", s.table, err)
+	}
+	return nil
+}
+
+// Revoke denylists id until expiresAt
+func (s *PgxStore) Revoke(ctx context.Context, id string, expiresAt time.Time) error {
+	_, err := s.ds.Querier(ctx).Exec(ctx, fmt.Sprintf(`
+		INSERT INTO %s (kind, id, expires_at) VALUES ($1, $2, $3)
+		ON CONFLICT (kind, id) DO UPDATE SET expires_at = GREATEST(%[1]s.expires_at, EXCLUDED.expires_at)`,
+		s.ident()), kindRevoked, id, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+	return nil
+}
+
+// IsRevoked reports whether any of the ids is denylisted
+func (s *PgxStore) IsRevoked(ctx context.Context, ids ...string) (bool, error) {
+	var revoked bool
+	err := s.ds.Querier(ctx).QueryRow(ctx, fmt.Sprintf(`
+		SELECT EXISTS (SELECT 1 FROM %s WHERE kind = $1 AND id = ANY($2) AND expires_at > now())`,
+		s.ident()), kindRevoked, ids).Scan(&revoked)
+	if err != nil {
+		return false, fmt.Errorf("failed to check token revocation: %w", err)
+	}
+	return revoked, nil
+}
+
+// Consume marks jti as used, false when it was already consumed
+func (s *PgxStore) Consume(ctx context.Context, jti string, expiresAt time.Time) (bool, error) {
+	tag, err := s.ds.Querier(ctx).Exec(ctx, fmt.Sprintf(`
+		INSERT INTO %s (kind, id, expires_at) VALUES ($1, $2, $3)
+		ON CONFLICT (kind, id) DO UPDATE SET expires_at = EXCLUDED.expires_at
+		WHERE %[1]s.expires_at <= now()`,
+		s.ident()), kindConsumed, jti, expiresAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to consume refresh token: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// Purge deletes expired entries, returning the number of rows removed
+func (s *PgxStore) Purge(ctx context.Context) (int64, error) {
+	tag, err := s.ds.Querier(ctx).Exec(ctx,
+		fmt.Sprintf(`DELETE FROM %s WHERE expires_at <= now()`, s.ident()))
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge %s: %w", s.table, err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// ident returns the quoted table name
+func (s *PgxStore) ident() string {
+	return pgxv5.Identifier{s.table}.Sanitize()
+}
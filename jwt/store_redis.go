@@ -0,0 +1,76 @@
+package jwt
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// defaultRedisStorePrefix namespaces the store keys
+const defaultRedisStorePrefix = "jwt:"
+
+// RedisStore is a Store shared by every instance through Redis, entries expire with their token
+type RedisStore struct {
+	client goredis.Cmdable
+	prefix string
+}
+
+// NewRedisStore creates a store on client, e.g. NewRedisStore(redis.GetClient())
+func NewRedisStore(client goredis.Cmdable) *RedisStore {
+	return &RedisStore{client: client, prefix: defaultRedisStorePrefix}
+}
+
+// WithPrefix overrides the key prefix, useful when several services share a Redis
+func (s *RedisStore) WithPrefix(prefix string) *RedisStore {
+	s.prefix = prefix
+	return s
+}
+
+// Revoke denylists id until expiresAt
+func (s *RedisStore) Revoke(ctx context.Context, id string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+
+	if err := s.client.Set(ctx, s.key(kindRevoked, id), 1, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+	return nil
+}
+
+// IsRevoked reports whether any of the ids is denylisted
+func (s *RedisStore) IsRevoked(ctx context.Context, ids ...string) (bool, error) {
+	if len(ids) == 0 {
+		return false, nil
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = s.key(kindRevoked, id)
+	}
+
+	n, err := s.client.Exists(ctx, keys...).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check revocation: %w", err)
+	}
+	return n > 0, nil
+}
+
+// Consume marks jti as used, false when it was already consumed
+func (s *RedisStore) Consume(ctx context.Context, jti string, expiresAt time.Time) (bool, error) {
+	// an expired token is rejected anyway, the entry only has to outlive the check
+	ttl := max(time.Until(expiresAt), time.Second)
+
+	first, err := s.client.SetNX(ctx, s.key(kindConsumed, jti), 1, ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to consume token: %w", err)
+	}
+	return first, nil
+}
+
+func (s *RedisStore) key(kind, id string) string {
+	return s.prefix + kind + ":" + id
+}
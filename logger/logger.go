@@ -2,59 +2,170 @@ package logger
 
 import (
 	"context"
-	"log"
+	"io"
+	"log/slog"
 	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cozy-hub-app/framework/env"
 )
 
 type contextKey string
 
 const loggerKey contextKey = "logger"
 
+//nolint:gochecknoglobals // shared fallback logger, created on first use
+var (
+	_default     Logger
+	_defaultOnce sync.Once
+)
+
+// output formats
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// LevelFatal is logged right before the process exits
+const LevelFatal = slog.Level(12)
+
 // Logger interface
+// args are key/value pairs, e.g. log.Info("request completed", "method", method, "duration_ms", 12)
 type Logger interface {
 	Info(msg string, args ...interface{})
 	Warn(msg string, args ...interface{})
 	Error(msg string, args ...interface{})
 	Fatal(msg string, args ...interface{})
 	Debug(msg string, args ...interface{})
+	// With returns a child logger that adds the key/value fields to every entry
+	With(args ...interface{}) Logger
+}
+
+// Options configures the structured logger
+type Options struct {
+	Level  slog.Level
+	Format string
+	Output io.Writer
+}
+
+// OptionsFromEnv builds logger options from LOG_LEVEL and LOG_FORMAT
+func OptionsFromEnv() Options {
+	return Options{
+		Level:  ParseLevel(env.GetOrDefault(env.LogLevel, "info")),
+		Format: strings.ToLower(env.GetOrDefault(env.LogFormat, FormatJSON)),
+		Output: os.Stdout,
+	}
 }
 
-// defaultLogger implements Logger interface
-type defaultLogger struct {
-	infoLog  *log.Logger
-	warnLog  *log.Logger
-	errorLog *log.Logger
-	debugLog *log.Logger
+// ParseLevel converts a level name (debug, info, warn, error, fatal) to slog.Level,
+// unknown values fall back to info
+func ParseLevel(level string) slog.Level {
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	case "fatal":
+		return LevelFatal
+	default:
+		return slog.LevelInfo
+	}
 }
 
-// New creates a new logger
+// slogLogger implements Logger interface on top of log/slog
+type slogLogger struct {
+	handler slog.Handler
+}
+
+// New creates a new logger configured from environment variables
 func New() Logger {
-	return &defaultLogger{
-		infoLog:  log.New(os.Stdout, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile),
-		warnLog:  log.New(os.Stdout, "WARN: ", log.Ldate|log.Ltime|log.Lshortfile),
-		errorLog: log.New(os.Stderr, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile),
-		debugLog: log.New(os.Stdout, "DEBUG: ", log.Ldate|log.Ltime|log.Lshortfile),
+	return NewWithOptions(OptionsFromEnv())
+}
+
+// NewWithOptions creates a new logger with the given options
+func NewWithOptions(opts Options) Logger {
+	if opts.Output == nil {
+		opts.Output = os.Stdout
+	}
+
+	handlerOpts := &slog.HandlerOptions{
+		AddSource:   true,
+		Level:       opts.Level,
+		ReplaceAttr: replaceAttr,
+	}
+
+	var handler slog.Handler
+	if opts.Format == FormatText {
+		handler = slog.NewTextHandler(opts.Output, handlerOpts)
+	} else {
+		handler = slog.NewJSONHandler(opts.Output, handlerOpts)
 	}
+
+	return NewWithHandler(handler)
+}
+
+// NewWithHandler creates a new logger backed by a custom slog.Handler
+func NewWithHandler(handler slog.Handler) Logger {
+	return &slogLogger{handler: handler}
+}
+
+// replaceAttr names the custom fatal level
+func replaceAttr(_ []string, a slog.Attr) slog.Attr {
+	if a.Key == slog.LevelKey {
+		if level, ok := a.Value.Any().(slog.Level); ok && level == LevelFatal {
+			a.Value = slog.StringValue("FATAL")
+		}
+	}
+	return a
 }
 
-func (l *defaultLogger) Info(msg string, args ...interface{}) {
-	l.infoLog.Printf(msg, args...)
+// log writes a record reporting the caller of the Logger method as source
+func (l *slogLogger) log(level slog.Level, msg string, args ...interface{}) {
+	ctx := context.Background()
+	if !l.handler.Enabled(ctx, level) {
+		return
+	}
+
+	// skip [runtime.Callers, log, Logger method]
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:])
+
+	r := slog.NewRecord(time.Now(), level, msg, pcs[0])
+	r.Add(args...)
+	_ = l.handler.Handle(ctx, r)
 }
 
-func (l *defaultLogger) Warn(msg string, args ...interface{}) {
-	l.warnLog.Printf(msg, args...)
+func (l *slogLogger) Info(msg string, args ...interface{}) {
+	l.log(slog.LevelInfo, msg, args...)
 }
 
-func (l *defaultLogger) Error(msg string, args ...interface{}) {
-	l.errorLog.Printf(msg, args...)
+func (l *slogLogger) Warn(msg string, args ...interface{}) {
+	l.log(slog.LevelWarn, msg, args...)
 }
 
-func (l *defaultLogger) Fatal(msg string, args ...interface{}) {
-	l.errorLog.Fatalf(msg, args...)
+func (l *slogLogger) Error(msg string, args ...interface{}) {
+	l.log(slog.LevelError, msg, args...)
 }
 
-func (l *defaultLogger) Debug(msg string, args ...interface{}) {
-	l.debugLog.Printf(msg, args...)
+func (l *slogLogger) Fatal(msg string, args ...interface{}) {
+	l.log(LevelFatal, msg, args...)
+	os.Exit(1)
+}
+
+func (l *slogLogger) Debug(msg string, args ...interface{}) {
+	l.log(slog.LevelDebug, msg, args...)
+}
+
+func (l *slogLogger) With(args ...interface{}) Logger {
+	if len(args) == 0 {
+		return l
+	}
+	return &slogLogger{handler: slog.New(l.handler).With(args...).Handler()}
 }
 
 // WithContext adds logger to context
@@ -62,15 +173,29 @@ func WithContext(ctx context.Context, logger Logger) context.Context {
 	return context.WithValue(ctx, loggerKey, logger)
 }
 
-// FromContext retrieves logger from context
+// FromContext retrieves logger from context, falls back to the shared default logger
 func FromContext(ctx context.Context) Logger {
 	if logger, ok := ctx.Value(loggerKey).(Logger); ok {
 		return logger
 	}
-	return New()
+	return defaultLogger()
+}
+
+// WithFields adds a child logger carrying the key/value fields to context,
+// every entry written through FromContext(ctx) is then tagged with them
+func WithFields(ctx context.Context, args ...interface{}) context.Context {
+	return WithContext(ctx, FromContext(ctx).With(args...))
 }
 
 // RestrictedGet return basic logger for framework internal usage
 func RestrictedGet() Logger {
-	return New()
-}
\ No newline at end of file
+	return defaultLogger()
+}
+
+// defaultLogger returns the shared logger configured from environment variables
+func defaultLogger() Logger {
+	_defaultOnce.Do(func() {
+		_default = New()
+	})
+	return _default
+}
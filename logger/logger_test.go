@@ -0,0 +1,83 @@
+package logger_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cozy-hub-app/framework/logger"
+)
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		name  string
+		level string
+		want  slog.Level
+	}{
+		{name: "Should parse debug", level: "debug", want: slog.LevelDebug},
+		{name: "Should parse upper case warn", level: "WARN", want: slog.LevelWarn},
+		{name: "Should parse warning alias", level: "warning", want: slog.LevelWarn},
+		{name: "Should parse error", level: "error", want: slog.LevelError},
+		{name: "Should parse fatal", level: "fatal", want: logger.LevelFatal},
+		{name: "Should fallback to info", level: "verbose", want: slog.LevelInfo},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, logger.ParseLevel(tt.level))
+		})
+	}
+}
+
+func TestJSONKeyValueFields(t *testing.T) {
+	var buf bytes.Buffer
+	log := logger.NewWithOptions(logger.Options{Level: slog.LevelInfo, Format: logger.FormatJSON, Output: &buf})
+
+	log.Info("gRPC request completed", "method", "/svc.v1.Cart/Get", "duration_ms", 12)
+
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "INFO", entry["level"])
+	assert.Equal(t, "gRPC request completed", entry["msg"])
+	assert.Equal(t, "/svc.v1.Cart/Get", entry["method"])
+	assert.InDelta(t, 12, entry["duration_ms"], 0)
+
+	source, ok := entry["source"].(map[string]any)
+	require.True(t, ok)
+	assert.True(t, strings.HasSuffix(source["file"].(string), "logger_test.go"))
+}
+
+func TestMinimumLevel(t *testing.T) {
+	var buf bytes.Buffer
+	log := logger.NewWithOptions(logger.Options{Level: slog.LevelWarn, Format: logger.FormatText, Output: &buf})
+
+	log.Debug("debug message")
+	log.Info("info message")
+	assert.Empty(t, buf.String())
+
+	log.Warn("warn message", "key", "value")
+	assert.Contains(t, buf.String(), "level=WARN")
+	assert.Contains(t, buf.String(), "key=value")
+}
+
+func TestWithFields(t *testing.T) {
+	var buf bytes.Buffer
+	base := logger.NewWithOptions(logger.Options{Level: slog.LevelInfo, Format: logger.FormatJSON, Output: &buf})
+
+	ctx := logger.WithContext(context.Background(), base)
+	ctx = logger.WithFields(ctx, "correlation_id", "abc-123")
+	ctx = logger.WithFields(ctx, "user_id", "42")
+
+	logger.FromContext(ctx).Info("cart updated", "items", 3)
+
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "abc-123", entry["correlation_id"])
+	assert.Equal(t, "42", entry["user_id"])
+	assert.InDelta(t, 3, entry["items"], 0)
+}
@@ -2,16 +2,21 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"strings"
 
 	"github.com/cozy-hub-app/framework/jwt"
+	"github.com/cozy-hub-app/framework/logger"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
 )
 
-// AuthInterceptor creates a gRPC unary interceptor that extracts user ID from JWT
-// and adds it to the request context metadata.
-// This allows authenticated endpoints to access the user ID via metadata.
+// ErrMissingToken is returned when the request carries no bearer token
+var ErrMissingToken = errors.New("missing bearer token")
+
+// AuthInterceptor creates a gRPC unary interceptor that validates the JWT
+// and stores the caller as a Principal in the request context.
+// Handlers read it with PrincipalFromContext or GetUserIDFromContext.
 func AuthInterceptor() grpc.UnaryServerInterceptor {
 	return func(
 		ctx context.Context,
@@ -19,52 +24,77 @@ func AuthInterceptor() grpc.UnaryServerInterceptor {
 		info *grpc.UnaryServerInfo,
 		handler grpc.UnaryHandler,
 	) (interface{}, error) {
-		// Extract authorization header from metadata
-		md, ok := metadata.FromIncomingContext(ctx)
-		if !ok {
-			// No metadata, continue without auth
-			return handler(ctx, req)
-		}
+		return handler(authenticate(ctx), req)
+	}
+}
+
+// AuthStreamInterceptor is the streaming counterpart of AuthInterceptor
+func AuthStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		return handler(srv, wrapServerStream(ss, authenticate(ss.Context())))
+	}
+}
+
+// authenticate validates the bearer token (if any) and stores the Principal in the context.
+// Requests without a valid token continue unauthenticated.
+func authenticate(ctx context.Context) context.Context {
+	ctx, _, _ = verifyToken(ctx)
+	return ctx
+}
 
-		// Get authorization header
-		authHeaders := md.Get("authorization")
-		if len(authHeaders) == 0 {
-			// Also try grpcgateway-authorization (from HTTP gateway)
-			authHeaders = md.Get("grpcgateway-authorization")
-		}
+// verifyToken validates the bearer token and returns the context carrying the Principal.
+// Returns ErrMissingToken when no bearer token is present, or the jwt validation error.
+func verifyToken(ctx context.Context) (context.Context, *jwt.JWTClaims, error) {
+	token := bearerToken(ctx)
+	if token == "" {
+		return ctx, nil, ErrMissingToken
+	}
 
-		if len(authHeaders) == 0 {
-			// No auth header, continue without setting user_id
-			return handler(ctx, req)
-		}
+	// Validate token (type and revocation included)
+	jwtManager := jwt.GetJWTManager()
+	claims, err := jwtManager.ValidateAccessToken(ctx, token)
+	if err != nil {
+		// The endpoint handler will return unauthorized if a principal is required
+		return ctx, nil, err
+	}
 
-		// Parse Bearer token
-		authHeader := authHeaders[0]
-		if !strings.HasPrefix(authHeader, "Bearer ") {
-			// Invalid format, continue without auth
-			return handler(ctx, req)
-		}
+	ctx = WithPrincipal(ctx, principalFromClaims(claims))
+	if claims.UserID != "" {
+		ctx = logger.WithFields(ctx, "user_id", claims.UserID)
+	}
 
-		token := strings.TrimPrefix(authHeader, "Bearer ")
-		if token == "" {
-			return handler(ctx, req)
-		}
+	return ctx, claims, nil
+}
 
-		// Validate token and extract user ID
-		jwtManager := jwt.GetJWTManager()
-		claims, err := jwtManager.ValidateToken(token)
-		if err != nil {
-			// Invalid token, continue without setting user_id
-			// The endpoint handler will return unauthorized if user_id is required
-			return handler(ctx, req)
-		}
+// bearerToken extracts the bearer token from the authorization metadata
+func bearerToken(ctx context.Context) string {
+	// Extract authorization header from metadata
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
 
-		// Add user_id to metadata
-		if claims.UserID != "" {
-			md = metadata.Join(md, metadata.Pairs("user_id", claims.UserID))
-			ctx = metadata.NewIncomingContext(ctx, md)
-		}
+	// Get authorization header
+	authHeaders := md.Get("authorization")
+	if len(authHeaders) == 0 {
+		// Also try grpcgateway-authorization (from HTTP gateway)
+		authHeaders = md.Get("grpcgateway-authorization")
+	}
+
+	if len(authHeaders) == 0 {
+		return ""
+	}
 
-		return handler(ctx, req)
+	// Parse Bearer token
+	authHeader := authHeaders[0]
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		return ""
 	}
+
+	return strings.TrimPrefix(authHeader, "Bearer ")
 }
@@ -0,0 +1,90 @@
+package middleware_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/cozy-hub-app/framework/env"
+	"github.com/cozy-hub-app/framework/jwt"
+	"github.com/cozy-hub-app/framework/middleware"
+)
+
+func TestAuthorizerPolicyFor(t *testing.T) {
+	authz := middleware.NewAuthorizer(middleware.Authenticated()).
+		WithPolicy("/auth.AuthService/*", middleware.Public()).
+		WithPolicy("/admin.AdminService/*", middleware.RequireRoles("admin")).
+		WithPolicy("/admin.AdminService/Stats", middleware.RequireRoles("admin", "support")).
+		WithPolicy("/auth.AuthService/Logout", middleware.Authenticated())
+
+	tests := []struct {
+		name   string
+		method string
+		want   middleware.Policy
+	}{
+		{name: "Should use exact match", method: "/auth.AuthService/Logout", want: middleware.Authenticated()},
+		{name: "Should use service wildcard", method: "/auth.AuthService/Login", want: middleware.Public()},
+		{name: "Should prefer exact over wildcard", method: "/admin.AdminService/Stats",
+			want: middleware.RequireRoles("admin", "support")},
+		{name: "Should use role wildcard", method: "/admin.AdminService/Ban", want: middleware.RequireRoles("admin")},
+		{name: "Should fallback to default", method: "/cart.CartService/Get", want: middleware.Authenticated()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, authz.PolicyFor(tt.method))
+		})
+	}
+}
+
+func TestAuthorizerAuthorize(t *testing.T) {
+	secret := strings.Repeat("test-secret-", 6)
+	t.Setenv(env.JWTSecretKey, secret)
+	tokens := jwt.NewJWTManager(secret, time.Minute, time.Hour, "cozy-hub-service")
+	expiredTokens := jwt.NewJWTManager(secret, -time.Minute, time.Hour, "cozy-hub-service")
+
+	user, err := tokens.GenerateAccessToken("user-1", "user@example.com")
+	require.NoError(t, err)
+	admin, err := tokens.GenerateAdminAccessToken("admin-1", "admin@example.com")
+	require.NoError(t, err)
+	expired, err := expiredTokens.GenerateAccessToken("user-1", "user@example.com")
+	require.NoError(t, err)
+
+	authz := middleware.NewAuthorizer(middleware.Authenticated()).
+		WithPolicy("/admin.AdminService/*", middleware.RequireRoles("admin"))
+
+	tests := []struct {
+		name   string
+		method string
+		token  string
+		want   codes.Code
+	}{
+		{"Should reject a missing token", "/cart.CartService/Get", "", codes.Unauthenticated},
+		{"Should reject an expired token", "/cart.CartService/Get", expired, codes.Unauthenticated},
+		{"Should accept a valid token", "/cart.CartService/Get", user, codes.OK},
+		{"Should reject a missing role", "/admin.AdminService/Ban", user, codes.PermissionDenied},
+		{"Should accept the role", "/admin.AdminService/Ban", admin, codes.OK},
+		{"Should allow health checks", "/grpc.health.v1.Health/Check", "", codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.token != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "Bearer "+tt.token))
+			}
+
+			info := &grpc.UnaryServerInfo{FullMethod: tt.method}
+			_, err := authz.UnaryServerInterceptor()(ctx, nil, info, func(context.Context, interface{}) (interface{}, error) {
+				return nil, nil
+			})
+			assert.Equal(t, tt.want, status.Code(err))
+		})
+	}
+}
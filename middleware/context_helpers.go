@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 
+	"github.com/cozy-hub-app/framework/jwt"
 	"google.golang.org/grpc/metadata"
 )
 
@@ -12,26 +13,40 @@ var (
 	ErrUserIDNotFound = errors.New("user_id not found in context")
 )
 
-// GetUserIDFromContext tries to extract user_id from both metadata and context value
+// legacyUserIDKey is the plain string key used before Principal existed
+const legacyUserIDKey = "user_id"
+
+// GetUserIDFromContext extracts the user ID of the authenticated caller
 // This is the preferred method for extracting user_id in handlers
-// Priority: metadata (set by auth middleware) > context value (legacy)
+// Priority: Principal (set by auth middleware) > context value (legacy)
+// Client supplied "user_id" metadata is never trusted.
 func GetUserIDFromContext(ctx context.Context) (string, error) {
-	// PRIORITY 1: Try metadata first (set by auth middleware)
-	userID, err := GetUserIDFromMetadata(ctx)
-	if err == nil && userID != "" {
-		return userID, nil
+	// PRIORITY 1: Principal set by the auth interceptors or SetUserIDInContext
+	if p, ok := PrincipalFromContext(ctx); ok && p.UserID != "" {
+		return p.UserID, nil
 	}
 
 	// PRIORITY 2: Try context value (legacy support)
-	if uid, ok := ctx.Value("user_id").(string); ok && uid != "" {
+	if uid, ok := ctx.Value(legacyUserIDKey).(string); ok && uid != "" {
 		return uid, nil
 	}
 
 	return "", ErrUserIDNotFound
 }
 
+// ClaimsFromContext returns the validated JWT claims attached by the auth interceptors.
+// Use jwt.CustomClaims to decode service specific claims.
+func ClaimsFromContext(ctx context.Context) (*jwt.JWTClaims, bool) {
+	p, ok := PrincipalFromContext(ctx)
+	if !ok || p.Claims == nil {
+		return nil, false
+	}
+	return p.Claims, true
+}
+
 // GetUserIDFromMetadata extracts user_id from gRPC metadata
-// This is set by the auth middleware after JWT validation
+// Deprecated: the auth middleware no longer writes user_id metadata and clients can forge it,
+// use GetUserIDFromContext or PrincipalFromContext.
 func GetUserIDFromMetadata(ctx context.Context) (string, error) {
 	md, ok := metadata.FromIncomingContext(ctx)
 	if !ok {
@@ -46,21 +61,10 @@ func GetUserIDFromMetadata(ctx context.Context) (string, error) {
 	return userIDs[0], nil
 }
 
-// SetUserIDInContext adds user_id to both context value and metadata
-// This is useful for propagating user_id to downstream services
+// SetUserIDInContext stores a Principal carrying userID in the context
+// This is useful for trusted in-process calls (jobs, tests) that act on behalf of a user
 func SetUserIDInContext(ctx context.Context, userID string) context.Context {
-	// Add to context value
-	ctx = context.WithValue(ctx, "user_id", userID)
-
-	// Add to metadata for gRPC propagation
-	md, ok := metadata.FromIncomingContext(ctx)
-	if !ok {
-		md = metadata.New(nil)
-	}
-	md = metadata.Join(md, metadata.Pairs("user_id", userID))
-	ctx = metadata.NewIncomingContext(ctx, md)
-
-	return ctx
+	return WithPrincipal(ctx, &Principal{UserID: userID, AuthMethod: AuthMethodInternal})
 }
 
 // GetUserIDOrEmpty returns user_id or empty string if not found
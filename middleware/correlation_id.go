@@ -3,6 +3,7 @@ package middleware
 import (
 	"context"
 
+	"github.com/cozy-hub-app/framework/logger"
 	"github.com/google/uuid"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
@@ -22,29 +23,48 @@ func CorrelationIDInterceptor() grpc.UnaryServerInterceptor {
 		info *grpc.UnaryServerInfo,
 		handler grpc.UnaryHandler,
 	) (interface{}, error) {
-		// Extract correlation ID from incoming metadata
-		var correlationID string
-		if md, ok := metadata.FromIncomingContext(ctx); ok {
-			if ids := md.Get("x-correlation-id"); len(ids) > 0 {
-				correlationID = ids[0]
-			}
-		}
+		// Continue with request
+		return handler(withCorrelationID(ctx, info.FullMethod), req)
+	}
+}
 
-		// Generate new correlation ID if not present
-		if correlationID == "" {
-			correlationID = uuid.New().String()
+// CorrelationIDStreamInterceptor is the streaming counterpart of CorrelationIDInterceptor
+func CorrelationIDStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		return handler(srv, wrapServerStream(ss, withCorrelationID(ss.Context(), info.FullMethod)))
+	}
+}
+
+// withCorrelationID propagates the incoming correlation ID (or a new one) through the context,
+// the outgoing metadata and the context logger
+func withCorrelationID(ctx context.Context, method string) context.Context {
+	// Extract correlation ID from incoming metadata
+	var correlationID string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get("x-correlation-id"); len(ids) > 0 {
+			correlationID = ids[0]
 		}
+	}
+
+	// Generate new correlation ID if not present
+	if correlationID == "" {
+		correlationID = uuid.New().String()
+	}
 
-		// Add correlation ID to context
-		ctx = context.WithValue(ctx, CorrelationIDKey, correlationID)
+	// Add correlation ID to context
+	ctx = context.WithValue(ctx, CorrelationIDKey, correlationID)
 
-		// Add correlation ID to outgoing metadata
-		md := metadata.Pairs("x-correlation-id", correlationID)
-		ctx = metadata.NewOutgoingContext(ctx, md)
+	// Tag every log line written for this request
+	ctx = logger.WithFields(ctx, "correlation_id", correlationID, "method", method)
 
-		// Continue with request
-		return handler(ctx, req)
-	}
+	// Add correlation ID to outgoing metadata
+	md := metadata.Pairs("x-correlation-id", correlationID)
+	return metadata.NewOutgoingContext(ctx, md)
 }
 
 // GetCorrelationID extracts correlation ID from context
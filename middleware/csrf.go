@@ -2,36 +2,119 @@ package middleware
 
 import (
 	"context"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"net/http"
 	"sync"
 	"time"
 
+	"github.com/cozy-hub-app/framework/env"
+	"github.com/cozy-hub-app/framework/jwt"
+	"github.com/cozy-hub-app/framework/logger"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
 
-// CSRFProtection implements CSRF token validation
+// mdCSRFToken carries the CSRF token, exposed as X-CSRF-Token by the gateway
+const mdCSRFToken = "x-csrf-token"
+
+// DefaultCSRFCookieName is the cookie holding the token for double-submit
+const DefaultCSRFCookieName = "csrf_token"
+
+// csrf token layout: nonce | expiry (unix seconds) | HMAC-SHA256(nonce | expiry | kind | len | value)
+const (
+	csrfNonceSize   = 16
+	csrfPayloadSize = csrfNonceSize + 8
+	csrfTokenSize   = csrfPayloadSize + sha256.Size
+)
+
+var (
+	// ErrInvalidCSRFToken is returned for malformed, forged, expired or foreign tokens
+	ErrInvalidCSRFToken = errors.New("invalid or expired CSRF token")
+	// ErrCSRFTokenUsed is returned for a token that was already used or invalidated
+	ErrCSRFTokenUsed = errors.New("CSRF token already used")
+	// ErrNoCSRFBinding is returned when the caller has neither a user nor a session
+	ErrNoCSRFBinding = errors.New("no user or session to bind the CSRF token to")
+)
+
+// binding kinds, part of the MAC so a user ID can never pass for a session ID
+const (
+	csrfBindUser    byte = 'u'
+	csrfBindSession byte = 's'
+)
+
+// CSRFBinding is what a token is bound to: a user or a session
+type CSRFBinding struct {
+	kind  byte
+	value string
+}
+
+// UserBinding binds a token to a user ID
+func UserBinding(userID string) CSRFBinding {
+	return CSRFBinding{kind: csrfBindUser, value: userID}
+}
+
+// SessionBinding binds a token to a session ID
+func SessionBinding(sessionID string) CSRFBinding {
+	return CSRFBinding{kind: csrfBindSession, value: sessionID}
+}
+
+// CSRFProtection implements CSRF token validation.
+// Tokens are HMAC-signed and bound to a user or session with an expiry, so any replica sharing
+// the secret can validate them. A jwt.Store records invalidated and, in one-time mode, used tokens.
 type CSRFProtection struct {
-	tokens map[string]*csrfToken
-	mu     sync.RWMutex
-	ttl    time.Duration
+	secret []byte
+	// ephemeral is set while the secret is random to this process
+	ephemeral bool
+	warnOnce  sync.Once
+	ttl       time.Duration
+	store     jwt.Store
+	oneTime   bool
+	cookie    http.Cookie
+
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
-type csrfToken struct {
-	token     string
-	createdAt time.Time
-	userID    string
+// purger is implemented by stores that need expired entries to be removed, like jwt.PgxStore
+type purger interface {
+	Purge(ctx context.Context) (int64, error)
 }
 
-// NewCSRFProtection creates a new CSRF protection middleware
+// NewCSRFProtection creates a new CSRF protection middleware.
+// The signing secret is CSRF_SECRET, or a random per-process key when unset: set it, or call
+// WithSecret, when several replicas serve the same clients, otherwise tokens issued by one replica
+// fail on the others. Outside dev and unit tests a random key is logged as a warning on first use.
+// Call Close to stop the cleanup routine.
 func NewCSRFProtection(ttl time.Duration) *CSRFProtection {
+	secret := []byte(env.Get(env.CSRFSecret))
+	ephemeral := len(secret) == 0
+	if ephemeral {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			panic(fmt.Sprintf("failed to generate CSRF secret: %v", err))
+		}
+	}
+
 	csrf := &CSRFProtection{
-		tokens: make(map[string]*csrfToken),
-		ttl:    ttl,
+		secret:    secret,
+		ephemeral: ephemeral,
+		ttl:       ttl,
+		store:     jwt.NewMemoryStore(),
+		cookie: http.Cookie{
+			Name:     DefaultCSRFCookieName,
+			Path:     "/",
+			Secure:   true,
+			SameSite: http.SameSiteStrictMode,
+		},
+		done: make(chan struct{}),
 	}
 
 	// Start cleanup routine
@@ -40,82 +123,257 @@ func NewCSRFProtection(ttl time.Duration) *CSRFProtection {
 	return csrf
 }
 
-// cleanupRoutine removes expired tokens
+// WithSecret sets the HMAC secret shared by every replica
+func (c *CSRFProtection) WithSecret(secret []byte) *CSRFProtection {
+	c.secret = secret
+	c.ephemeral = false
+	return c
+}
+
+// WithStore shares used and invalidated tokens between replicas, e.g. jwt.NewRedisStore or jwt.NewPgxStore
+func (c *CSRFProtection) WithStore(store jwt.Store) *CSRFProtection {
+	c.store = store
+	return c
+}
+
+// WithOneTimeUse rejects a token once it has been validated
+func (c *CSRFProtection) WithOneTimeUse() *CSRFProtection {
+	c.oneTime = true
+	return c
+}
+
+// WithCookie overrides the name, path, domain, Secure and SameSite attributes of the token cookie
+func (c *CSRFProtection) WithCookie(cookie http.Cookie) *CSRFProtection {
+	c.cookie = cookie
+	return c
+}
+
+// Close stops the cleanup routine, it is safe to call more than once
+func (c *CSRFProtection) Close() error {
+	c.closeOnce.Do(func() { close(c.done) })
+	return nil
+}
+
+// cleanupRoutine purges expired entries of stores that do not expire them on their own
 func (c *CSRFProtection) cleanupRoutine() {
-	ticker := time.NewTicker(c.ttl)
+	interval := c.ttl
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		c.mu.Lock()
-		now := time.Now()
-		for key, token := range c.tokens {
-			if now.Sub(token.createdAt) > c.ttl {
-				delete(c.tokens, key)
-			}
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+
+		p, ok := c.store.(purger)
+		if !ok {
+			continue
+		}
+		if _, err := p.Purge(context.Background()); err != nil {
+			logger.RestrictedGet().Warn("failed to purge CSRF tokens", "error", err)
 		}
-		c.mu.Unlock()
 	}
 }
 
-// GenerateToken generates a new CSRF token for a user
+// GenerateToken generates a new CSRF token bound to a user ID
 func (c *CSRFProtection) GenerateToken(userID string) (string, error) {
-	// Generate random token
-	b := make([]byte, 32)
-	if _, err := rand.Read(b); err != nil {
+	return c.GenerateTokenFor(UserBinding(userID))
+}
+
+// GenerateTokenFor generates a new CSRF token bound to a user or session
+func (c *CSRFProtection) GenerateTokenFor(binding CSRFBinding) (string, error) {
+	c.warnOnce.Do(func() {
+		if c.ephemeral && !isDevEnvironment() {
+			logger.RestrictedGet().Warn("CSRF_SECRET is not set, CSRF tokens are only valid on this replica")
+		}
+	})
+
+	// Generate random nonce
+	b := make([]byte, csrfTokenSize)
+	if _, err := rand.Read(b[:csrfNonceSize]); err != nil {
 		return "", err
 	}
-	token := base64.URLEncoding.EncodeToString(b)
+	binary.BigEndian.PutUint64(b[csrfNonceSize:csrfPayloadSize], uint64(time.Now().Add(c.ttl).Unix()))
+	copy(b[csrfPayloadSize:], c.sign(b[:csrfPayloadSize], binding))
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
 
-	// Store token
-	c.mu.Lock()
-	defer c.mu.Unlock()
+// IssueToken generates a token for the caller and sends it in the x-csrf-token header and the
+// csrf cookie, which the gateway forwards as X-CSRF-Token and Set-Cookie
+func (c *CSRFProtection) IssueToken(ctx context.Context) (string, error) {
+	bindings := csrfBindings(ctx)
+	if len(bindings) == 0 {
+		return "", ErrNoCSRFBinding
+	}
+
+	token, err := c.GenerateTokenFor(bindings[0])
+	if err != nil {
+		return "", err
+	}
 
-	c.tokens[token] = &csrfToken{
-		token:     token,
-		createdAt: time.Now(),
-		userID:    userID,
+	if err := grpc.SetHeader(ctx, metadata.Pairs(
+		mdCSRFToken, token,
+		"set-cookie", c.Cookie(token).String(),
+	)); err != nil {
+		return "", fmt.Errorf("failed to send CSRF token: %w", err)
 	}
 
 	return token, nil
 }
 
-// ValidateToken validates a CSRF token
+// Cookie returns the double-submit cookie of token, readable by scripts so they can echo it
+func (c *CSRFProtection) Cookie(token string) *http.Cookie {
+	cookie := c.cookie
+	cookie.Value = token
+	cookie.MaxAge = int(c.ttl.Seconds())
+	cookie.HttpOnly = false
+	return &cookie
+}
+
+// ValidateToken validates a CSRF token, in one-time mode the token is consumed
 func (c *CSRFProtection) ValidateToken(token, userID string) bool {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+	return c.VerifyToken(context.Background(), token, UserBinding(userID)) == nil
+}
 
-	csrfToken, exists := c.tokens[token]
-	if !exists {
-		return false
+// VerifyToken checks the signature, binding and expiry of token, then checks the store for
+// invalidation and, in one-time mode, consumes it. bindings are tried in order.
+func (c *CSRFProtection) VerifyToken(ctx context.Context, token string, bindings ...CSRFBinding) error {
+	id, expiresAt, err := c.parse(token, bindings)
+	if err != nil {
+		return err
+	}
+
+	if c.oneTime {
+		first, err := c.store.Consume(ctx, id, expiresAt)
+		if err != nil {
+			return fmt.Errorf("failed to consume CSRF token: %w", err)
+		}
+		if !first {
+			return ErrCSRFTokenUsed
+		}
+		return nil
+	}
+
+	revoked, err := c.store.IsRevoked(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to check CSRF token: %w", err)
+	}
+	if revoked {
+		return ErrCSRFTokenUsed
+	}
+	return nil
+}
+
+// InvalidateToken rejects a CSRF token from now on
+func (c *CSRFProtection) InvalidateToken(token string) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(b) != csrfTokenSize {
+		return
+	}
+
+	id := csrfTokenID(b)
+	expiresAt := time.Unix(int64(binary.BigEndian.Uint64(b[csrfNonceSize:csrfPayloadSize])), 0)
+
+	ctx := context.Background()
+	if c.oneTime {
+		_, err = c.store.Consume(ctx, id, expiresAt)
+	} else {
+		err = c.store.Revoke(ctx, id, expiresAt)
+	}
+	if err != nil {
+		logger.RestrictedGet().Warn("failed to invalidate CSRF token", "error", err)
+	}
+}
+
+// parse verifies token against one of the bindings and returns its store id and expiry
+func (c *CSRFProtection) parse(token string, bindings []CSRFBinding) (string, time.Time, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(b) != csrfTokenSize {
+		return "", time.Time{}, ErrInvalidCSRFToken
+	}
+
+	// Check if token belongs to user or session
+	payload, mac := b[:csrfPayloadSize], b[csrfPayloadSize:]
+	bound := false
+	for _, binding := range bindings {
+		if hmac.Equal(mac, c.sign(payload, binding)) {
+			bound = true
+			break
+		}
+	}
+	if !bound {
+		return "", time.Time{}, ErrInvalidCSRFToken
 	}
 
 	// Check if token expired
-	if time.Since(csrfToken.createdAt) > c.ttl {
-		return false
+	expiresAt := time.Unix(int64(binary.BigEndian.Uint64(payload[csrfNonceSize:])), 0)
+	if !time.Now().Before(expiresAt) {
+		return "", time.Time{}, ErrInvalidCSRFToken
 	}
 
-	// Check if token belongs to user
-	if csrfToken.userID != userID {
+	return csrfTokenID(b), expiresAt, nil
+}
+
+// sign computes the MAC of a token payload bound to binding, the value is length-prefixed
+func (c *CSRFProtection) sign(payload []byte, binding CSRFBinding) []byte {
+	h := hmac.New(sha256.New, c.secret)
+	h.Write(payload)
+	h.Write([]byte{binding.kind})
+	_ = binary.Write(h, binary.BigEndian, uint32(len(binding.value)))
+	h.Write([]byte(binding.value))
+	return h.Sum(nil)
+}
+
+// isDevEnvironment reports whether ENVIRONMENT is dev or unittest
+func isDevEnvironment() bool {
+	switch env.Get(env.Environment) {
+	case env.Dev, env.UnitTest:
+		return true
+	default:
 		return false
 	}
+}
 
-	return true
+// csrfTokenID is the store id of a token, namespaced from JWT ids sharing the store
+func csrfTokenID(token []byte) string {
+	return "csrf:" + base64.RawURLEncoding.EncodeToString(token[:csrfNonceSize])
 }
 
-// InvalidateToken removes a CSRF token
-func (c *CSRFProtection) InvalidateToken(token string) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	delete(c.tokens, token)
+// csrfBindings returns what a token of the caller may be bound to: the user ID, then the session
+// of an authenticated caller. The client-supplied x-session-id is only used for anonymous callers.
+func csrfBindings(ctx context.Context) []CSRFBinding {
+	if p, ok := PrincipalFromContext(ctx); ok {
+		var bindings []CSRFBinding
+		if p.UserID != "" {
+			bindings = append(bindings, UserBinding(p.UserID))
+		}
+		if p.Claims != nil && p.Claims.SessionID != "" {
+			bindings = append(bindings, SessionBinding(p.Claims.SessionID))
+		}
+		return bindings
+	}
+	if userID := GetUserIDOrEmpty(ctx); userID != "" {
+		return []CSRFBinding{UserBinding(userID)}
+	}
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get("x-session-id"); len(ids) > 0 && ids[0] != "" {
+			return []CSRFBinding{SessionBinding(ids[0])}
+		}
+	}
+	return nil
 }
 
-// UnaryServerInterceptor returns a gRPC interceptor for CSRF protection
+// UnaryServerInterceptor returns a gRPC interceptor for CSRF protection,
+// see Interceptor to chain both kinds in GRPCServer
 func (c *CSRFProtection) UnaryServerInterceptor(protectedMethods []string) grpc.UnaryServerInterceptor {
-	// Create method map for fast lookup
-	methodMap := make(map[string]bool)
-	for _, method := range protectedMethods {
-		methodMap[method] = true
-	}
+	methodMap := methodSet(protectedMethods)
 
 	return func(
 		ctx context.Context,
@@ -128,34 +386,103 @@ func (c *CSRFProtection) UnaryServerInterceptor(protectedMethods []string) grpc.
 			return handler(ctx, req)
 		}
 
-		// Extract CSRF token from metadata
-		md, ok := metadata.FromIncomingContext(ctx)
-		if !ok {
-			return nil, status.Error(codes.InvalidArgument, "missing metadata")
+		if err := c.check(ctx); err != nil {
+			return nil, err
 		}
 
-		csrfTokens := md.Get("x-csrf-token")
-		if len(csrfTokens) == 0 {
-			return nil, status.Error(codes.InvalidArgument, "missing CSRF token")
-		}
-		csrfToken := csrfTokens[0]
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns a gRPC stream interceptor for CSRF protection
+func (c *CSRFProtection) StreamServerInterceptor(protectedMethods []string) grpc.StreamServerInterceptor {
+	methodMap := methodSet(protectedMethods)
 
-		// Extract user ID from context
-		userID, ok := ctx.Value("user_id").(string)
-		if !ok || userID == "" {
-			return nil, status.Error(codes.Unauthenticated, "user not authenticated")
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		// Skip CSRF check for unprotected methods
+		if !methodMap[info.FullMethod] {
+			return handler(srv, ss)
 		}
 
-		// Validate token
-		if !c.ValidateToken(csrfToken, userID) {
-			return nil, status.Error(codes.PermissionDenied, "invalid or expired CSRF token")
+		if err := c.check(ss.Context()); err != nil {
+			return err
 		}
 
-		return handler(ctx, req)
+		return handler(srv, ss)
+	}
+}
+
+// CSRFInterceptor guards protected methods with both interceptors, it can be passed as is
+// to server.GRPCServer.WithServiceInterceptors
+type CSRFInterceptor struct {
+	csrf             *CSRFProtection
+	protectedMethods []string
+}
+
+// Interceptor returns the unary and stream interceptors guarding protectedMethods
+func (c *CSRFProtection) Interceptor(protectedMethods []string) *CSRFInterceptor {
+	return &CSRFInterceptor{csrf: c, protectedMethods: protectedMethods}
+}
+
+// UnaryServerInterceptor returns the unary interceptor
+func (i *CSRFInterceptor) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return i.csrf.UnaryServerInterceptor(i.protectedMethods)
+}
+
+// StreamServerInterceptor returns the stream interceptor
+func (i *CSRFInterceptor) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return i.csrf.StreamServerInterceptor(i.protectedMethods)
+}
+
+// check validates the x-csrf-token metadata against the user or session of the caller
+func (c *CSRFProtection) check(ctx context.Context) error {
+	// Extract CSRF token from metadata
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return status.Error(codes.InvalidArgument, "missing metadata")
+	}
+
+	csrfTokens := md.Get(mdCSRFToken)
+	if len(csrfTokens) == 0 {
+		return status.Error(codes.InvalidArgument, "missing CSRF token")
+	}
+
+	bindings := csrfBindings(ctx)
+	if len(bindings) == 0 {
+		return status.Error(codes.Unauthenticated, "user not authenticated")
+	}
+
+	// Validate token
+	err := c.VerifyToken(ctx, csrfTokens[0], bindings...)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, ErrInvalidCSRFToken), errors.Is(err, ErrCSRFTokenUsed):
+		return status.Error(codes.PermissionDenied, err.Error())
+	default:
+		logger.FromContext(ctx).Error("CSRF store unavailable", "error", err)
+		return status.Error(codes.Unavailable, "CSRF validation unavailable")
+	}
+}
+
+// methodSet creates method map for fast lookup
+func methodSet(methods []string) map[string]bool {
+	set := make(map[string]bool, len(methods))
+	for _, method := range methods {
+		set[method] = true
 	}
+	return set
 }
 
 // HTTPMiddleware provides CSRF protection for HTTP endpoints
+//
+// Deprecated: it reads :path from gRPC metadata and cannot wrap an http.Handler,
+// use server.CSRFMiddleware on the gateway instead
 func (c *CSRFProtection) HTTPMiddleware(protectedPaths []string) func(next func(ctx context.Context, req interface{}) (interface{}, error)) func(ctx context.Context, req interface{}) (interface{}, error) {
 	pathMap := make(map[string]bool)
 	for _, path := range protectedPaths {
@@ -181,18 +508,18 @@ func (c *CSRFProtection) HTTPMiddleware(protectedPaths []string) func(next func(
 			}
 
 			// Extract and validate CSRF token
-			csrfTokens := md.Get("x-csrf-token")
+			csrfTokens := md.Get(mdCSRFToken)
 			if len(csrfTokens) == 0 {
 				return nil, fmt.Errorf("missing CSRF token")
 			}
 
-			userID, ok := ctx.Value("user_id").(string)
-			if !ok || userID == "" {
+			bindings := csrfBindings(ctx)
+			if len(bindings) == 0 {
 				return nil, fmt.Errorf("user not authenticated")
 			}
 
-			if !c.ValidateToken(csrfTokens[0], userID) {
-				return nil, fmt.Errorf("invalid or expired CSRF token")
+			if err := c.VerifyToken(ctx, csrfTokens[0], bindings...); err != nil {
+				return nil, err
 			}
 
 			return next(ctx, req)
@@ -0,0 +1,116 @@
+package middleware_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/cozy-hub-app/framework/jwt"
+	"github.com/cozy-hub-app/framework/middleware"
+)
+
+func newCSRF(t *testing.T, ttl time.Duration) *middleware.CSRFProtection {
+	t.Helper()
+	csrf := middleware.NewCSRFProtection(ttl).WithSecret([]byte("test-secret"))
+	t.Cleanup(func() { _ = csrf.Close() })
+	return csrf
+}
+
+func TestCSRFProtection(t *testing.T) {
+	csrf := newCSRF(t, time.Minute)
+	token, err := csrf.GenerateToken("user-1")
+	require.NoError(t, err)
+
+	assert.True(t, csrf.ValidateToken(token, "user-1"))
+	assert.True(t, csrf.ValidateToken(token, "user-1"), "Should allow reuse by default")
+	assert.False(t, csrf.ValidateToken(token, "user-2"), "Should reject a token bound to another user")
+	assert.False(t, csrf.ValidateToken(token+"x", "user-1"))
+
+	t.Run("Should not let a user ID pass for a session binding", func(t *testing.T) {
+		forged, err := csrf.GenerateToken("session:s-1")
+		require.NoError(t, err)
+		assert.ErrorIs(t, csrf.VerifyToken(context.Background(), forged, middleware.SessionBinding("s-1")),
+			middleware.ErrInvalidCSRFToken)
+		assert.ErrorIs(t, csrf.VerifyToken(context.Background(), forged, middleware.UserBinding("session:s")),
+			middleware.ErrInvalidCSRFToken)
+	})
+
+	t.Run("Should validate on another replica sharing the secret", func(t *testing.T) {
+		assert.True(t, newCSRF(t, time.Minute).ValidateToken(token, "user-1"))
+	})
+
+	t.Run("Should reject an invalidated token", func(t *testing.T) {
+		csrf.InvalidateToken(token)
+		assert.ErrorIs(t, csrf.VerifyToken(context.Background(), token, middleware.UserBinding("user-1")),
+			middleware.ErrCSRFTokenUsed)
+	})
+
+	t.Run("Should reject an expired token", func(t *testing.T) {
+		expired, err := newCSRF(t, -time.Second).GenerateToken("user-1")
+		require.NoError(t, err)
+		assert.ErrorIs(t, csrf.VerifyToken(context.Background(), expired, middleware.UserBinding("user-1")),
+			middleware.ErrInvalidCSRFToken)
+	})
+}
+
+func TestCSRFProtectionOneTimeUse(t *testing.T) {
+	store := jwt.NewMemoryStore()
+	first := newCSRF(t, time.Minute).WithStore(store).WithOneTimeUse()
+	second := newCSRF(t, time.Minute).WithStore(store).WithOneTimeUse()
+
+	token, err := first.GenerateToken("user-1")
+	require.NoError(t, err)
+
+	require.NoError(t, second.VerifyToken(context.Background(), token, middleware.UserBinding("user-1")))
+	assert.ErrorIs(t, first.VerifyToken(context.Background(), token, middleware.UserBinding("user-1")),
+		middleware.ErrCSRFTokenUsed, "Should share used tokens through the store")
+}
+
+func TestCSRFInterceptorBindings(t *testing.T) {
+	csrf := newCSRF(t, time.Minute)
+	sessionToken, err := csrf.GenerateTokenFor(middleware.SessionBinding("s-1"))
+	require.NoError(t, err)
+	userToken, err := csrf.GenerateTokenFor(middleware.UserBinding("user-1"))
+	require.NoError(t, err)
+
+	const method = "/cart.v1.CartService/AddItem"
+	interceptor := csrf.UnaryServerInterceptor([]string{method})
+	handler := func(context.Context, interface{}) (interface{}, error) { return "ok", nil }
+
+	tests := []struct {
+		name      string
+		principal *middleware.Principal
+		token     string
+		wantCode  codes.Code
+	}{
+		{"Should accept a session token of an anonymous caller", nil, sessionToken, codes.OK},
+		{"Should accept a user token of an authenticated caller", &middleware.Principal{UserID: "user-1"}, userToken, codes.OK},
+		{
+			"Should ignore x-session-id for an authenticated caller",
+			&middleware.Principal{UserID: "user-1"},
+			sessionToken,
+			codes.PermissionDenied,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+				"x-csrf-token", tt.token,
+				"x-session-id", "s-1",
+			))
+			if tt.principal != nil {
+				ctx = middleware.WithPrincipal(ctx, tt.principal)
+			}
+
+			_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+			assert.Equal(t, tt.wantCode, status.Code(err))
+		})
+	}
+}
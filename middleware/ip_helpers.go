@@ -3,7 +3,6 @@ package middleware
 import (
 	"context"
 	"errors"
-	"strings"
 
 	"google.golang.org/grpc/metadata"
 )
@@ -13,37 +12,16 @@ var (
 	ErrIPNotFound = errors.New("client IP address not found")
 )
 
-// ExtractClientIP gets the client IP address from trusted proxy headers
-// Priority: X-Real-IP (most reliable) > X-Forwarded-For rightmost (client IP)
+// ExtractClientIP gets the client IP address of the request
+// The configured proxy header (X-Forwarded-For by default) is only honored when set by a trusted
+// proxy, see TrustedProxies.ClientIP; the gRPC peer address is the fallback
 // Returns error if no IP can be determined
 func ExtractClientIP(ctx context.Context) (string, error) {
-	md, ok := metadata.FromIncomingContext(ctx)
-	if !ok {
-		return "", errors.New("no metadata in context")
-	}
-
-	// PRIORITY 1: X-Real-IP header (set by trusted reverse proxies like nginx, cloudflare)
-	// This is the most reliable source for client IP
-	if xrip := md.Get("x-real-ip"); len(xrip) > 0 && xrip[0] != "" {
-		return strings.TrimSpace(xrip[0]), nil
-	}
-
-	// PRIORITY 2: X-Forwarded-For header
-	// Format: "client, proxy1, proxy2, ..."
-	// We want the leftmost IP (original client), but validate it's not empty
-	if xff := md.Get("x-forwarded-for"); len(xff) > 0 && xff[0] != "" {
-		// Split by comma and get first IP (client IP)
-		parts := strings.Split(xff[0], ",")
-		if len(parts) > 0 {
-			clientIP := strings.TrimSpace(parts[0])
-			if clientIP != "" {
-				return clientIP, nil
-			}
-		}
+	addr, err := GetTrustedProxies().ClientIP(ctx)
+	if err != nil {
+		return "", err
 	}
-
-	// No valid IP found
-	return "", ErrIPNotFound
+	return addr.String(), nil
 }
 
 // ExtractClientIPOrEmpty returns the client IP or empty string if not found
@@ -12,6 +12,8 @@ import (
 )
 
 // LoggingInterceptor returns a gRPC interceptor that logs request/response details
+// The context logger is expected to be tagged with correlation_id, method and user_id by
+// CorrelationIDInterceptor and AuthInterceptor, so chain it after them
 func LoggingInterceptor() grpc.UnaryServerInterceptor {
 	return func(
 		ctx context.Context,
@@ -20,59 +22,71 @@ func LoggingInterceptor() grpc.UnaryServerInterceptor {
 		handler grpc.UnaryHandler,
 	) (interface{}, error) {
 		start := time.Now()
+		ctx = withMethodLogger(ctx, info.FullMethod)
 
-		// Get logger from context
-		log := logger.FromContext(ctx)
+		// Log request start
+		logger.FromContext(ctx).Info("gRPC request started")
 
-		// Extract correlation ID if present
-		if md, ok := metadata.FromIncomingContext(ctx); ok {
-			if ids := md.Get("x-correlation-id"); len(ids) > 0 {
-				ctx = logger.WithContext(ctx, log)
-			}
-		}
+		// Call handler
+		resp, err := handler(ctx, req)
 
-		// Extract user ID from context if present
-		userID := ""
-		if uid, ok := ctx.Value("user_id").(string); ok {
-			userID = uid
-		}
+		logCompletion(ctx, "gRPC request", start, err)
+		return resp, err
+	}
+}
 
-		// Log request start
-		log.Info("gRPC request started",
-			"method", info.FullMethod,
-			"user_id", userID,
-		)
+// LoggingStreamInterceptor is the streaming counterpart of LoggingInterceptor
+func LoggingStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		start := time.Now()
+		ctx := withMethodLogger(ss.Context(), info.FullMethod)
+
+		// Log stream start
+		logger.FromContext(ctx).Info("gRPC stream started")
 
 		// Call handler
-		resp, err := handler(ctx, req)
+		err := handler(srv, wrapServerStream(ss, ctx))
 
-		// Calculate duration
-		duration := time.Since(start)
+		logCompletion(ctx, "gRPC stream", start, err)
+		return err
+	}
+}
 
-		// Extract status
-		st, _ := status.FromError(err)
-		statusCode := st.Code()
+// withMethodLogger tags the context logger with the method when CorrelationIDInterceptor did not run
+func withMethodLogger(ctx context.Context, method string) context.Context {
+	if GetCorrelationID(ctx) == "" {
+		return logger.WithFields(ctx, "method", method)
+	}
+	return ctx
+}
 
-		// Log request completion
-		if err != nil {
-			log.Error("gRPC request failed",
-				"method", info.FullMethod,
-				"user_id", userID,
-				"duration_ms", duration.Milliseconds(),
-				"status_code", statusCode.String(),
-				"error", err.Error(),
-			)
-		} else {
-			log.Info("gRPC request completed",
-				"method", info.FullMethod,
-				"user_id", userID,
-				"duration_ms", duration.Milliseconds(),
-				"status_code", "OK",
-			)
-		}
+// logCompletion logs the outcome of a gRPC call
+func logCompletion(ctx context.Context, kind string, start time.Time, err error) {
+	log := logger.FromContext(ctx)
 
-		return resp, err
+	// Calculate duration
+	duration := time.Since(start)
+
+	// Log request completion
+	if err != nil {
+		st, _ := status.FromError(err)
+		log.Error(kind+" failed",
+			"duration_ms", duration.Milliseconds(),
+			"status_code", st.Code().String(),
+			"error", err.Error(),
+		)
+		return
 	}
+
+	log.Info(kind+" completed",
+		"duration_ms", duration.Milliseconds(),
+		"status_code", "OK",
+	)
 }
 
 // HTTPLoggingMiddleware logs HTTP gateway requests
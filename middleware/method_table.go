@@ -0,0 +1,54 @@
+package middleware
+
+import "strings"
+
+// wildcard matches every method, or every method of a service when used as "/pkg.Service/*"
+const wildcard = "*"
+
+// methodTable resolves a value per full gRPC method: exact match, then the longest
+// wildcard prefix, then the fallback
+type methodTable[T any] struct {
+	exact    map[string]T
+	prefixes map[string]T
+	fallback T
+}
+
+// newMethodTable creates a table returning fallback for unmatched methods
+func newMethodTable[T any](fallback T) *methodTable[T] {
+	return &methodTable[T]{
+		exact:    make(map[string]T),
+		prefixes: make(map[string]T),
+		fallback: fallback,
+	}
+}
+
+// set binds v to a full method ("/pkg.Service/Method"), a whole service ("/pkg.Service/*")
+// or every method ("*")
+func (t *methodTable[T]) set(pattern string, v T) {
+	switch {
+	case pattern == wildcard:
+		t.fallback = v
+	case strings.HasSuffix(pattern, wildcard):
+		t.prefixes[strings.TrimSuffix(pattern, wildcard)] = v
+	default:
+		t.exact[pattern] = v
+	}
+}
+
+// lookup returns the value bound to method
+func (t *methodTable[T]) lookup(method string) T {
+	if v, ok := t.exact[method]; ok {
+		return v
+	}
+
+	best := -1
+	v := t.fallback
+	for prefix, pv := range t.prefixes {
+		if strings.HasPrefix(method, prefix) && len(prefix) > best {
+			best = len(prefix)
+			v = pv
+		}
+	}
+
+	return v
+}
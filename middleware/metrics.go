@@ -7,10 +7,14 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
 var (
+	// Recorded for calls whose handler panicked
+	errHandlerPanicked = status.Error(codes.Internal, "handler panicked")
+
 	// Request counter
 	requestsTotal = promauto.NewCounterVec(
 		prometheus.CounterOpts{
@@ -67,6 +71,15 @@ var (
 		},
 		[]string{"method", "error_code"},
 	)
+
+	// Rate limit denials
+	rateLimitExceeded = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rate_limit_exceeded_total",
+			Help: "Total number of requests that exceeded rate limits",
+		},
+		[]string{"method", "policy", "key", "tier"},
+	)
 )
 
 // MetricsInterceptor returns a gRPC interceptor that collects Prometheus metrics
@@ -76,16 +89,61 @@ func MetricsInterceptor() grpc.UnaryServerInterceptor {
 		req interface{},
 		info *grpc.UnaryServerInfo,
 		handler grpc.UnaryHandler,
-	) (interface{}, error) {
-		method := info.FullMethod
-		start := time.Now()
+	) (resp interface{}, err error) {
+		done := observe(info.FullMethod)
+		// deferred so a panicking handler still leaves the active requests
+		panicked := true
+		defer func() {
+			if panicked {
+				done(errHandlerPanicked)
+				return
+			}
+			done(err)
+		}()
 
-		// Increment active requests
-		activeRequests.WithLabelValues(method).Inc()
-		defer activeRequests.WithLabelValues(method).Dec()
+		// Call handler
+		resp, err = handler(ctx, req)
+		panicked = false
+		return resp, err
+	}
+}
+
+// MetricsStreamInterceptor is the streaming counterpart of MetricsInterceptor,
+// the duration covers the whole stream
+func MetricsStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) (err error) {
+		done := observe(info.FullMethod)
+		// deferred so a panicking handler still leaves the active requests
+		panicked := true
+		defer func() {
+			if panicked {
+				done(errHandlerPanicked)
+				return
+			}
+			done(err)
+		}()
 
 		// Call handler
-		resp, err := handler(ctx, req)
+		err = handler(srv, ss)
+		panicked = false
+		return err
+	}
+}
+
+// observe starts tracking a call and returns the function recording its outcome
+func observe(method string) func(err error) {
+	start := time.Now()
+
+	// Increment active requests
+	activeRequests.WithLabelValues(method).Inc()
+
+	return func(err error) {
+		activeRequests.WithLabelValues(method).Dec()
 
 		// Record duration
 		duration := time.Since(start).Seconds()
@@ -101,24 +159,12 @@ func MetricsInterceptor() grpc.UnaryServerInterceptor {
 
 		// Increment request counter
 		requestsTotal.WithLabelValues(method, statusCode).Inc()
-
-		return resp, err
 	}
 }
 
 // InitMetrics initializes custom application metrics
 func InitMetrics() {
-	// Database connection pool metrics
-	promauto.NewGaugeFunc(
-		prometheus.GaugeOpts{
-			Name: "db_connections_active",
-			Help: "Number of active database connections",
-		},
-		func() float64 {
-			// This will be updated by the application
-			return 0
-		},
-	)
+	// Database connection pool metrics are exported by the pgx package
 
 	// Cache metrics
 	promauto.NewCounter(
@@ -144,11 +190,5 @@ func InitMetrics() {
 		[]string{"method", "result"},
 	)
 
-	// Rate limit metrics
-	promauto.NewCounter(
-		prometheus.CounterOpts{
-			Name: "rate_limit_exceeded_total",
-			Help: "Total number of requests that exceeded rate limits",
-		},
-	)
+	// Rate limit metrics are recorded by the rate limiters
 }
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"context"
+	"slices"
+
+	"github.com/cozy-hub-app/framework/jwt"
+)
+
+// Authentication methods of a Principal
+const (
+	// AuthMethodJWT is set by the auth interceptors for bearer tokens
+	AuthMethodJWT = "jwt"
+	// AuthMethodInternal is set by SetUserIDInContext for trusted in-process calls
+	AuthMethodInternal = "internal"
+)
+
+type principalContextKey struct{}
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	UserID     string
+	Email      string
+	Role       string
+	Scopes     []string
+	TokenID    string
+	AuthMethod string
+	// Claims is the validated token, nil when the principal was not authenticated by JWT
+	Claims *jwt.JWTClaims
+}
+
+// WithPrincipal stores the principal in the context
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, p)
+}
+
+// PrincipalFromContext returns the authenticated caller, false for anonymous requests
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalContextKey{}).(*Principal)
+	return p, ok && p != nil
+}
+
+// HasRole reports whether the principal has one of the roles
+func (p *Principal) HasRole(roles ...string) bool {
+	return p.Role != "" && slices.Contains(roles, p.Role)
+}
+
+// HasScope reports whether the principal was granted scope
+func (p *Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+// principalFromClaims builds the principal of a validated JWT
+func principalFromClaims(claims *jwt.JWTClaims) *Principal {
+	return &Principal{
+		UserID:     claims.UserID,
+		Email:      claims.Email,
+		Role:       claims.Role,
+		Scopes:     claims.Scopes,
+		TokenID:    claims.ID,
+		AuthMethod: AuthMethodJWT,
+		Claims:     claims,
+	}
+}
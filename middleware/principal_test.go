@@ -0,0 +1,42 @@
+package middleware_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/cozy-hub-app/framework/middleware"
+)
+
+func TestGetUserIDFromContext(t *testing.T) {
+	t.Run("Should read the principal", func(t *testing.T) {
+		ctx := middleware.WithPrincipal(context.Background(), &middleware.Principal{UserID: "user-1", Role: "admin"})
+
+		userID, err := middleware.GetUserIDFromContext(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "user-1", userID)
+
+		p, ok := middleware.PrincipalFromContext(ctx)
+		require.True(t, ok)
+		assert.True(t, p.HasRole("support", "admin"))
+	})
+
+	t.Run("Should not trust client metadata", func(t *testing.T) {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("user_id", "forged"))
+
+		_, err := middleware.GetUserIDFromContext(ctx)
+		assert.ErrorIs(t, err, middleware.ErrUserIDNotFound)
+	})
+
+	t.Run("Should set an internal principal", func(t *testing.T) {
+		ctx := middleware.SetUserIDInContext(context.Background(), "user-2")
+
+		p, ok := middleware.PrincipalFromContext(ctx)
+		require.True(t, ok)
+		assert.Equal(t, "user-2", p.UserID)
+		assert.Equal(t, middleware.AuthMethodInternal, p.AuthMethod)
+	})
+}
@@ -0,0 +1,215 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Algorithm selects how a Limit is enforced
+type Algorithm string
+
+const (
+	// AlgorithmFixedWindow allows Rate requests per window starting at the first request.
+	// Cheap, but up to 2x Rate can pass around a window edge.
+	AlgorithmFixedWindow Algorithm = "fixed_window"
+	// AlgorithmTokenBucket refills Rate tokens per Window continuously, up to Burst tokens
+	AlgorithmTokenBucket Algorithm = "token_bucket"
+	// AlgorithmGCRA is the generic cell rate algorithm: a token bucket stored as a single timestamp
+	AlgorithmGCRA Algorithm = "gcra"
+	// AlgorithmSlidingWindow weights the previous window count by its overlap with the sliding window
+	AlgorithmSlidingWindow Algorithm = "sliding_window"
+)
+
+// ParseAlgorithm parses an algorithm name, empty defaults to AlgorithmFixedWindow
+func ParseAlgorithm(name string) (Algorithm, error) {
+	switch alg := Algorithm(strings.ToLower(strings.TrimSpace(name))); alg {
+	case "":
+		return AlgorithmFixedWindow, nil
+	case AlgorithmFixedWindow, AlgorithmTokenBucket, AlgorithmGCRA, AlgorithmSlidingWindow:
+		return alg, nil
+	default:
+		return "", fmt.Errorf("unknown rate limit algorithm %q", name)
+	}
+}
+
+// algorithm returns the effective algorithm of the limit
+func (l Limit) algorithm() Algorithm {
+	if l.Algorithm == "" {
+		return AlgorithmFixedWindow
+	}
+	return l.Algorithm
+}
+
+// burst returns the bucket capacity, defaulting to Rate
+func (l Limit) burst() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return l.Rate
+}
+
+// valid reports whether the limit can be evaluated, invalid limits deny every request
+func (l Limit) valid() bool {
+	// the Redis scripts work in milliseconds, a shorter window would reach them as zero
+	if l.Rate <= 0 || l.Window < time.Millisecond {
+		return false
+	}
+	// GCRA spaces requests by Window/Rate, which must not round down to zero
+	return l.Algorithm != AlgorithmGCRA || l.Window/time.Duration(l.Rate) > 0
+}
+
+// rateState is the per-key state of every algorithm, only the fields of limit.Algorithm are used
+type rateState struct {
+	// fixed window
+	count   int
+	resetAt time.Time
+	// sliding window, aligned on multiples of the window
+	windowIndex int64
+	prevCount   int
+	// token bucket
+	tokens float64
+	last   time.Time
+	// GCRA theoretical arrival time
+	tat time.Time
+}
+
+// allow consumes one request at now and returns the decision
+func (s *rateState) allow(now time.Time, limit Limit) RateLimitResult {
+	if !limit.valid() {
+		return RateLimitResult{RetryAfter: limit.Window, ResetAfter: limit.Window}
+	}
+
+	switch limit.Algorithm {
+	case AlgorithmTokenBucket:
+		return s.tokenBucket(now, limit)
+	case AlgorithmGCRA:
+		return s.gcra(now, limit)
+	case AlgorithmSlidingWindow:
+		return s.slidingWindow(now, limit)
+	default:
+		return s.fixedWindow(now, limit)
+	}
+}
+
+// expiresAt returns when the state no longer affects decisions and can be dropped
+func (s *rateState) expiresAt(limit Limit) time.Time {
+	switch limit.Algorithm {
+	case AlgorithmTokenBucket:
+		missing := float64(limit.burst()) - s.tokens
+		return s.last.Add(time.Duration(missing * float64(limit.Window) / float64(limit.Rate)))
+	case AlgorithmGCRA:
+		return s.tat
+	case AlgorithmSlidingWindow:
+		return time.Unix(0, (s.windowIndex+2)*int64(limit.Window))
+	default:
+		return s.resetAt
+	}
+}
+
+func (s *rateState) fixedWindow(now time.Time, limit Limit) RateLimitResult {
+	if !now.Before(s.resetAt) {
+		s.count = 0
+		s.resetAt = now.Add(limit.Window)
+	}
+	s.count++
+
+	return fixedWindowResult(s.count, limit, s.resetAt.Sub(now))
+}
+
+func (s *rateState) tokenBucket(now time.Time, limit Limit) RateLimitResult {
+	burst := float64(limit.burst())
+	// tokens per nanosecond
+	refill := float64(limit.Rate) / float64(limit.Window)
+
+	if s.last.IsZero() {
+		s.tokens = burst
+	} else if elapsed := now.Sub(s.last); elapsed > 0 {
+		s.tokens = math.Min(burst, s.tokens+float64(elapsed)*refill)
+	}
+	s.last = now
+
+	result := RateLimitResult{Limit: limit.burst()}
+	if s.tokens >= 1 {
+		s.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration(math.Ceil((1 - s.tokens) / refill))
+	}
+	result.Remaining = int(math.Floor(s.tokens))
+	result.ResetAfter = time.Duration(math.Ceil((burst - s.tokens) / refill))
+	return result
+}
+
+func (s *rateState) gcra(now time.Time, limit Limit) RateLimitResult {
+	interval := limit.Window / time.Duration(limit.Rate)
+	tolerance := interval * time.Duration(limit.burst())
+
+	tat := s.tat
+	if tat.Before(now) {
+		tat = now
+	}
+	newTat := tat.Add(interval)
+	allowAt := newTat.Add(-tolerance)
+
+	result := RateLimitResult{Limit: limit.burst()}
+	if now.Before(allowAt) {
+		result.RetryAfter = allowAt.Sub(now)
+		result.ResetAfter = tat.Sub(now)
+		return result
+	}
+
+	s.tat = newTat
+	result.Allowed = true
+	result.Remaining = int(now.Sub(allowAt) / interval)
+	result.ResetAfter = newTat.Sub(now)
+	return result
+}
+
+func (s *rateState) slidingWindow(now time.Time, limit Limit) RateLimitResult {
+	window := int64(limit.Window)
+	index := now.UnixNano() / window
+	elapsed := now.UnixNano() - index*window
+
+	switch index {
+	case s.windowIndex:
+	case s.windowIndex + 1:
+		s.prevCount, s.count = s.count, 0
+	default:
+		s.prevCount, s.count = 0, 0
+	}
+	s.windowIndex = index
+
+	weight := float64(window-elapsed) / float64(window)
+	estimate := float64(s.prevCount)*weight + float64(s.count)
+
+	result := RateLimitResult{Limit: limit.Rate}
+	if estimate+1 > float64(limit.Rate) {
+		result.RetryAfter = slidingRetryAfter(s.count, s.prevCount, limit.Rate, elapsed, window)
+	} else {
+		s.count++
+		estimate++
+		result.Allowed = true
+	}
+
+	result.Remaining = max(int(math.Floor(float64(limit.Rate)-estimate)), 0)
+	result.ResetAfter = time.Duration(window - elapsed)
+	if s.count > 0 {
+		result.ResetAfter += time.Duration(window)
+	}
+	return result
+}
+
+// slidingRetryAfter computes when the weighted estimate leaves room for one more request
+func slidingRetryAfter(count, prevCount, rate int, elapsed, window int64) time.Duration {
+	if count+1 > rate {
+		// wait for the next window, then for the current count to slide out enough
+		slide := float64(window) * (1 - float64(rate-1)/float64(count))
+		return time.Duration(window-elapsed) + time.Duration(math.Ceil(slide))
+	}
+
+	// the previous window must slide out until prev*weight + count + 1 <= rate
+	target := float64(window) * (1 - float64(rate-1-count)/float64(prevCount))
+	return time.Duration(math.Ceil(target)) - time.Duration(elapsed)
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRedisScriptsMatchMemory replays the same requests through the Redis scripts and the
+// in-memory algorithms, Redis works in milliseconds so durations may differ by 1ms
+func TestRedisScriptsMatchMemory(t *testing.T) {
+	limits := []Limit{
+		{Rate: 3, Window: 10 * time.Second},
+		{Rate: 3, Window: 10 * time.Second, Algorithm: AlgorithmTokenBucket, Burst: 4},
+		{Rate: 3, Window: 10 * time.Second, Algorithm: AlgorithmGCRA, Burst: 2},
+		{Rate: 3, Window: 10 * time.Second, Algorithm: AlgorithmSlidingWindow},
+	}
+	// offsets of the requests from the start, several land on the same instant
+	offsets := []time.Duration{
+		0, 0, 0, 0, 0,
+		1 * time.Second, 2500 * time.Millisecond, 2500 * time.Millisecond,
+		4 * time.Second, 7 * time.Second, 7 * time.Second,
+		11 * time.Second, 11 * time.Second, 12 * time.Second, 12 * time.Second,
+		23 * time.Second, 23 * time.Second, 23 * time.Second, 23 * time.Second,
+		60 * time.Second,
+	}
+	// aligned on the window so the sliding window starts a fresh window
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, limit := range limits {
+		t.Run(string(limit.algorithm()), func(t *testing.T) {
+			m := miniredis.RunT(t)
+			client := goredis.NewClient(&goredis.Options{Addr: m.Addr()})
+			t.Cleanup(func() { _ = client.Close() })
+			store := NewRedisRateLimitStore(client)
+
+			var state rateState
+			last := time.Duration(0)
+			for i, offset := range offsets {
+				now := start.Add(offset)
+				m.SetTime(now)
+				m.FastForward(offset - last)
+				last = offset
+
+				got, err := store.Allow(context.Background(), "key", limit)
+				require.NoError(t, err)
+				want := state.allow(now, limit)
+
+				assert.Equal(t, want.Allowed, got.Allowed, "request %d at %s: allowed", i, offset)
+				assert.Equal(t, want.Limit, got.Limit, "request %d at %s: limit", i, offset)
+				assert.Equal(t, want.Remaining, got.Remaining, "request %d at %s: remaining", i, offset)
+				assert.InDelta(t, want.RetryAfter, got.RetryAfter, float64(time.Millisecond),
+					"request %d at %s: retry after", i, offset)
+				assert.InDelta(t, want.ResetAfter, got.ResetAfter, float64(time.Millisecond),
+					"request %d at %s: reset after", i, offset)
+			}
+		})
+	}
+}
+
+func TestLimitValid(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit Limit
+		want  bool
+	}{
+		{"Should accept a positive limit", Limit{Rate: 10, Window: time.Second}, true},
+		{"Should reject a zero rate", Limit{Window: time.Second}, false},
+		{"Should reject a zero window", Limit{Rate: 10}, false},
+		{"Should accept a dense fixed window", Limit{Rate: 10, Window: time.Millisecond}, true},
+		{"Should reject a window under a millisecond", Limit{Rate: 10, Window: time.Microsecond}, false},
+		{"Should reject a zero GCRA interval", Limit{Rate: 2_000_000, Window: time.Millisecond, Algorithm: AlgorithmGCRA}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.limit.valid())
+		})
+	}
+
+	_, err := LimitConfig{Rate: 10, Window: time.Nanosecond, Algorithm: "gcra"}.limit()
+	assert.Error(t, err, "Should reject the policy when it is compiled")
+}
@@ -0,0 +1,467 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/cozy-hub-app/framework/env"
+	"github.com/cozy-hub-app/framework/logger"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// built-in key extractors of rate limit policies
+const (
+	// RateLimitKeyUser keys authenticated callers by user ID and anonymous ones by IP
+	RateLimitKeyUser = "user"
+	// RateLimitKeyIP keys callers by client IP
+	RateLimitKeyIP = "ip"
+	// RateLimitKeyAPIKey keys callers by the hashed x-api-key header once verified
+	// (see WithAPIKeyVerifier), falling back to IP
+	RateLimitKeyAPIKey = "api_key"
+	// RateLimitKeySession keys callers by the session of their token, or by the x-session-id
+	// header once verified (see WithSessionVerifier), falling back to IP
+	RateLimitKeySession = "session"
+	// RateLimitKeyGlobal shares one bucket between every caller
+	RateLimitKeyGlobal = "global"
+)
+
+// TierGuest is the tier of anonymous callers
+const TierGuest = "guest"
+
+// KeyExtractor returns the rate limit identifier of the caller
+type KeyExtractor func(ctx context.Context) (string, error)
+
+// CredentialVerifier validates a client-supplied credential and returns its stable identifier,
+// e.g. the ID of an API key
+type CredentialVerifier func(ctx context.Context, value string) (string, error)
+
+// TierResolver returns the tier of the caller, used to pick the limit of a policy
+type TierResolver func(ctx context.Context) string
+
+// RateLimitConfig is the declarative rate limit configuration, usually loaded from YAML:
+//
+//	policies:
+//	  - name: login
+//	    methods: ["/auth.AuthService/Login"]
+//	    key: ip
+//	    rate: 5
+//	    window: 1m
+//	  - name: api
+//	    methods: ["*"]
+//	    key: user
+//	    algorithm: token_bucket
+//	    rate: 100
+//	    window: 1m
+//	    tiers:
+//	      guest: {rate: 20}
+//	      admin: {rate: 1000, burst: 2000}
+type RateLimitConfig struct {
+	Policies []RateLimitPolicy `yaml:"policies"`
+}
+
+// RateLimitPolicy applies a limit to the methods it matches, keyed by an extractor
+type RateLimitPolicy struct {
+	Name string `yaml:"name"`
+	// Methods are full methods, "/pkg.Service/*" or "*", like Authorizer.WithPolicy
+	Methods []string `yaml:"methods"`
+	// Key is the name of a key extractor, defaults to RateLimitKeyUser
+	Key string `yaml:"key"`
+	// PerMethod gives every matched method its own bucket instead of sharing one
+	PerMethod bool `yaml:"per_method"`
+	// LimitConfig is the limit of callers without a tier entry
+	LimitConfig `yaml:",inline"`
+	// Tiers override the limit per tier, unset fields are inherited from the policy
+	Tiers map[string]LimitConfig `yaml:"tiers"`
+}
+
+// LimitConfig is the YAML form of a Limit, window is a duration like "1m"
+type LimitConfig struct {
+	Algorithm string        `yaml:"algorithm"`
+	Rate      int           `yaml:"rate"`
+	Window    time.Duration `yaml:"window"`
+	Burst     int           `yaml:"burst"`
+}
+
+// LoadRateLimitConfig reads a YAML rate limit configuration, ${VAR} references are expanded
+func LoadRateLimitConfig(filePath string) (*RateLimitConfig, error) {
+	var cfg RateLimitConfig
+	if err := env.LoadYAMLInto(filePath, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to load rate limit policies: %w", err)
+	}
+	return &cfg, nil
+}
+
+// RateLimitConfigFromEnv reads the file named by RATE_LIMIT_POLICY_FILE
+func RateLimitConfigFromEnv() (*RateLimitConfig, error) {
+	filePath := env.Get(env.RateLimitPolicyFile)
+	if filePath == "" {
+		return nil, fmt.Errorf("%s is not set", env.RateLimitPolicyFile)
+	}
+	return LoadRateLimitConfig(filePath)
+}
+
+// merge fills the unset fields of l from base
+func (l LimitConfig) merge(base LimitConfig) LimitConfig {
+	if l.Algorithm == "" {
+		l.Algorithm = base.Algorithm
+	}
+	if l.Rate == 0 {
+		l.Rate = base.Rate
+	}
+	if l.Window == 0 {
+		l.Window = base.Window
+	}
+	if l.Burst == 0 {
+		l.Burst = base.Burst
+	}
+	return l
+}
+
+// limit validates and converts the configuration
+func (l LimitConfig) limit() (Limit, error) {
+	alg, err := ParseAlgorithm(l.Algorithm)
+	if err != nil {
+		return Limit{}, err
+	}
+
+	limit := Limit{Rate: l.Rate, Window: l.Window, Algorithm: alg, Burst: l.Burst}
+	if l.Rate <= 0 || l.Window <= 0 {
+		return Limit{}, errors.New("rate and window must be positive")
+	}
+	if !limit.valid() {
+		return Limit{}, fmt.Errorf("window %s is too short for %d %s requests", l.Window, l.Rate, alg)
+	}
+	return limit, nil
+}
+
+// compiledPolicy is a validated RateLimitPolicy
+type compiledPolicy struct {
+	name      string
+	key       string
+	extractor KeyExtractor
+	perMethod bool
+	// limit applies to tiers without an entry, nil leaves them unlimited
+	limit *Limit
+	tiers map[string]Limit
+}
+
+// PolicyRateLimiter enforces declarative rate limit policies, which can be reloaded at runtime
+type PolicyRateLimiter struct {
+	store         RateLimitStore
+	failurePolicy FailurePolicy
+	extractors    map[string]KeyExtractor
+	resolveTier   TierResolver
+	verifyAPIKey  CredentialVerifier
+	verifySession CredentialVerifier
+	policies      atomic.Pointer[methodTable[*compiledPolicy]]
+}
+
+// NewPolicyRateLimiter creates a limiter without policies backed by an in-memory store,
+// load policies with Reload or LoadFile once the extractors are registered
+func NewPolicyRateLimiter() *PolicyRateLimiter {
+	rl := &PolicyRateLimiter{
+		store: NewMemoryRateLimitStore(),
+		extractors: map[string]KeyExtractor{
+			RateLimitKeyUser:   ExtractIdentifierForRateLimit,
+			RateLimitKeyIP:     extractIPKey,
+			RateLimitKeyGlobal: extractGlobalKey,
+		},
+		resolveTier: roleTier,
+	}
+	rl.extractors[RateLimitKeyAPIKey] = rl.extractAPIKey
+	rl.extractors[RateLimitKeySession] = rl.extractSessionKey
+	rl.policies.Store(newMethodTable[*compiledPolicy](nil))
+	return rl
+}
+
+// WithStore replaces the in-memory store, e.g. with a RedisRateLimitStore shared by every replica
+func (rl *PolicyRateLimiter) WithStore(store RateLimitStore) *PolicyRateLimiter {
+	rl.store = store
+	return rl
+}
+
+// WithFailurePolicy sets the behavior when the store errors, FailOpen by default
+func (rl *PolicyRateLimiter) WithFailurePolicy(policy FailurePolicy) *PolicyRateLimiter {
+	rl.failurePolicy = policy
+	return rl
+}
+
+// WithKeyExtractor registers a custom extractor usable as the key of a policy
+func (rl *PolicyRateLimiter) WithKeyExtractor(name string, extractor KeyExtractor) *PolicyRateLimiter {
+	rl.extractors[name] = extractor
+	return rl
+}
+
+// WithAPIKeyVerifier validates x-api-key before it is used as a rate limit key
+func (rl *PolicyRateLimiter) WithAPIKeyVerifier(verifier CredentialVerifier) *PolicyRateLimiter {
+	rl.verifyAPIKey = verifier
+	return rl
+}
+
+// WithSessionVerifier validates x-session-id before it is used as a rate limit key
+func (rl *PolicyRateLimiter) WithSessionVerifier(verifier CredentialVerifier) *PolicyRateLimiter {
+	rl.verifySession = verifier
+	return rl
+}
+
+// WithTierResolver replaces the default resolver, which uses the principal role or TierGuest
+func (rl *PolicyRateLimiter) WithTierResolver(resolver TierResolver) *PolicyRateLimiter {
+	rl.resolveTier = resolver
+	return rl
+}
+
+// Reload validates cfg and atomically replaces the current policies.
+// The current policies are kept when cfg is invalid.
+func (rl *PolicyRateLimiter) Reload(cfg *RateLimitConfig) error {
+	table := newMethodTable[*compiledPolicy](nil)
+	for i, p := range cfg.Policies {
+		compiled, err := rl.compile(p)
+		if err != nil {
+			return fmt.Errorf("invalid rate limit policy %d (%s): %w", i, p.Name, err)
+		}
+		for _, method := range p.Methods {
+			table.set(method, compiled)
+		}
+	}
+
+	rl.policies.Store(table)
+	return nil
+}
+
+// LoadFile loads and applies a YAML configuration
+func (rl *PolicyRateLimiter) LoadFile(filePath string) error {
+	cfg, err := LoadRateLimitConfig(filePath)
+	if err != nil {
+		return err
+	}
+	return rl.Reload(cfg)
+}
+
+// WatchFile reloads the policies whenever the modification time of the file changes,
+// until ctx is done. Invalid files are logged and the current policies are kept.
+// It blocks, e.g. app.WithWorker("rate-limit-policies", func(ctx context.Context) error {
+// return rl.WatchFile(ctx, path, 30*time.Second) })
+func (rl *PolicyRateLimiter) WatchFile(ctx context.Context, filePath string, interval time.Duration) error {
+	var modTime time.Time
+	if info, err := os.Stat(filePath); err == nil {
+		modTime = info.ModTime()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(filePath)
+		if err != nil {
+			logger.FromContext(ctx).Warn("failed to stat rate limit policies", "path", filePath, "error", err)
+			continue
+		}
+		if info.ModTime().Equal(modTime) {
+			continue
+		}
+		modTime = info.ModTime()
+
+		if err := rl.LoadFile(filePath); err != nil {
+			logger.FromContext(ctx).Error("keeping current rate limit policies", "path", filePath, "error", err)
+			continue
+		}
+		logger.FromContext(ctx).Info("rate limit policies reloaded", "path", filePath)
+	}
+}
+
+// compile validates a policy and resolves its extractor and limits
+func (rl *PolicyRateLimiter) compile(p RateLimitPolicy) (*compiledPolicy, error) {
+	if p.Name == "" {
+		return nil, errors.New("name is required")
+	}
+	if len(p.Methods) == 0 {
+		return nil, errors.New("at least one method is required")
+	}
+
+	key := p.Key
+	if key == "" {
+		key = RateLimitKeyUser
+	}
+	extractor, ok := rl.extractors[key]
+	if !ok {
+		return nil, fmt.Errorf("unknown key extractor %q", key)
+	}
+
+	compiled := &compiledPolicy{
+		name:      p.Name,
+		key:       key,
+		extractor: extractor,
+		perMethod: p.PerMethod,
+		tiers:     make(map[string]Limit, len(p.Tiers)),
+	}
+
+	if p.Rate != 0 {
+		limit, err := p.LimitConfig.limit()
+		if err != nil {
+			return nil, err
+		}
+		compiled.limit = &limit
+	}
+	for tier, lc := range p.Tiers {
+		limit, err := lc.merge(p.LimitConfig).limit()
+		if err != nil {
+			return nil, fmt.Errorf("tier %s: %w", tier, err)
+		}
+		compiled.tiers[tier] = limit
+	}
+
+	if compiled.limit == nil && len(compiled.tiers) == 0 {
+		return nil, errors.New("a rate or at least one tier is required")
+	}
+	return compiled, nil
+}
+
+// UnaryServerInterceptor returns a gRPC unary server interceptor for rate limiting
+func (rl *PolicyRateLimiter) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		if err := rl.check(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+
+		// Continue with request
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns a gRPC stream server interceptor for rate limiting,
+// each stream counts as one request
+func (rl *PolicyRateLimiter) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		if err := rl.check(ss.Context(), info.FullMethod); err != nil {
+			return err
+		}
+
+		// Continue with stream
+		return handler(srv, ss)
+	}
+}
+
+// check applies the policy of method to the caller
+func (rl *PolicyRateLimiter) check(ctx context.Context, method string) error {
+	policy := rl.policies.Load().lookup(method)
+	if policy == nil {
+		return nil
+	}
+
+	tier := rl.resolveTier(ctx)
+	limit, ok := policy.tiers[tier]
+	if !ok {
+		if policy.limit == nil {
+			return nil
+		}
+		limit = *policy.limit
+	}
+
+	// SECURITY: Reject requests that cannot be identified to prevent rate limit bypass
+	identifier, err := policy.extractor(ctx)
+	if err != nil {
+		return status.Errorf(
+			codes.FailedPrecondition,
+			"unable to identify client for rate limiting: %v", err,
+		)
+	}
+
+	key := "policy:" + policy.name + ":" + tier + ":"
+	if policy.perMethod {
+		key += method + ":"
+	}
+	key += identifier
+
+	return enforceLimit(ctx, rl.store, rl.failurePolicy, key, limit, rateLimitLabels{
+		method: method,
+		policy: policy.name,
+		key:    policy.key,
+		tier:   tier,
+	})
+}
+
+// roleTier uses the principal role as tier, anonymous callers are TierGuest
+func roleTier(ctx context.Context) string {
+	if p, ok := PrincipalFromContext(ctx); ok && p.Role != "" {
+		return p.Role
+	}
+	return TierGuest
+}
+
+func extractIPKey(ctx context.Context) (string, error) {
+	ip, err := ExtractClientIP(ctx)
+	if err != nil {
+		return "", err
+	}
+	return "ip:" + ip, nil
+}
+
+// extractAPIKey keys on the API key once the verifier accepted it. Unverified header values
+// are client-chosen, a fresh one per request would get a fresh bucket, so they fall back to IP.
+func (rl *PolicyRateLimiter) extractAPIKey(ctx context.Context) (string, error) {
+	if id, ok := rl.verifiedHeader(ctx, "x-api-key", rl.verifyAPIKey); ok {
+		// hashed so the key never reaches the store in clear text
+		sum := sha256.Sum256([]byte(id))
+		return "apikey:" + hex.EncodeToString(sum[:]), nil
+	}
+	return extractIPKey(ctx)
+}
+
+// extractSessionKey keys on the session of the token, or on a verified x-session-id, else on IP
+func (rl *PolicyRateLimiter) extractSessionKey(ctx context.Context) (string, error) {
+	if claims, ok := ClaimsFromContext(ctx); ok && claims.SessionID != "" {
+		return "session:" + claims.SessionID, nil
+	}
+	if id, ok := rl.verifiedHeader(ctx, "x-session-id", rl.verifySession); ok {
+		return "session:" + id, nil
+	}
+	return extractIPKey(ctx)
+}
+
+// verifiedHeader returns the identifier of a metadata value accepted by verify
+func (rl *PolicyRateLimiter) verifiedHeader(ctx context.Context, key string, verify CredentialVerifier) (string, bool) {
+	if verify == nil {
+		return "", false
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(key)
+	if len(values) == 0 || values[0] == "" {
+		return "", false
+	}
+
+	id, err := verify(ctx, values[0])
+	if err != nil || id == "" {
+		return "", false
+	}
+	return id, true
+}
+
+func extractGlobalKey(context.Context) (string, error) {
+	return "global", nil
+}
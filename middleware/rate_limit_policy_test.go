@@ -0,0 +1,133 @@
+package middleware_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/cozy-hub-app/framework/middleware"
+)
+
+const testRateLimitPolicies = `
+policies:
+  - name: login
+    methods: ["/auth.AuthService/Login"]
+    key: ip
+    rate: 1
+    window: 1m
+  - name: api
+    methods: ["/cart.CartService/*"]
+    key: api_key
+    rate: 2
+    window: 1m
+    tiers:
+      admin: {rate: 3}
+`
+
+func writePolicies(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "rate_limits.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func callPolicyLimited(rl *middleware.PolicyRateLimiter, method string, p *middleware.Principal) error {
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("198.51.100.1"), Port: 1}})
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("x-api-key", "secret"))
+	if p != nil {
+		ctx = middleware.WithPrincipal(ctx, p)
+	}
+
+	info := &grpc.UnaryServerInfo{FullMethod: method}
+	_, err := rl.UnaryServerInterceptor()(ctx, nil, info, func(context.Context, interface{}) (interface{}, error) {
+		return nil, nil
+	})
+	return err
+}
+
+func allowedCalls(rl *middleware.PolicyRateLimiter, method string, p *middleware.Principal) int {
+	for i := 0; i < 10; i++ {
+		if err := callPolicyLimited(rl, method, p); err != nil {
+			return i
+		}
+	}
+	return 10
+}
+
+func TestPolicyRateLimiter(t *testing.T) {
+	rl := middleware.NewPolicyRateLimiter()
+	require.NoError(t, rl.LoadFile(writePolicies(t, testRateLimitPolicies)))
+
+	assert.Equal(t, 1, allowedCalls(rl, "/auth.AuthService/Login", nil))
+	assert.Equal(t, 2, allowedCalls(rl, "/cart.CartService/Get", nil), "Should apply the policy limit to guests")
+	assert.Equal(t, 3, allowedCalls(rl, "/cart.CartService/Get", &middleware.Principal{Role: "admin"}),
+		"Should apply the tier limit")
+	assert.Equal(t, 10, allowedCalls(rl, "/health.Health/Check", nil), "Should not limit unmatched methods")
+
+	err := callPolicyLimited(rl, "/auth.AuthService/Login", nil)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
+
+func TestPolicyRateLimiterReload(t *testing.T) {
+	rl := middleware.NewPolicyRateLimiter()
+	require.NoError(t, rl.LoadFile(writePolicies(t, testRateLimitPolicies)))
+
+	err := rl.LoadFile(writePolicies(t, "policies:\n  - name: bad\n    methods: [\"*\"]\n    key: unknown\n    rate: 1\n    window: 1m\n"))
+	require.Error(t, err)
+	assert.Equal(t, 1, allowedCalls(rl, "/auth.AuthService/Login", nil), "Should keep the current policies")
+
+	require.NoError(t, rl.Reload(&middleware.RateLimitConfig{}))
+	assert.Equal(t, 10, allowedCalls(rl, "/auth.AuthService/Login", nil), "Should apply the new policies")
+}
+
+func TestPolicyRateLimiterAPIKey(t *testing.T) {
+	policies := &middleware.RateLimitConfig{Policies: []middleware.RateLimitPolicy{{
+		Name:        "api",
+		Methods:     []string{"*"},
+		Key:         middleware.RateLimitKeyAPIKey,
+		LimitConfig: middleware.LimitConfig{Rate: 1, Window: time.Minute},
+	}}}
+	call := func(rl *middleware.PolicyRateLimiter, key string) error {
+		ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("198.51.100.1"), Port: 1}})
+		ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("x-api-key", key))
+		info := &grpc.UnaryServerInfo{FullMethod: "/cart.CartService/Get"}
+		_, err := rl.UnaryServerInterceptor()(ctx, nil, info, func(context.Context, interface{}) (interface{}, error) {
+			return nil, nil
+		})
+		return err
+	}
+
+	t.Run("Should key unverified API keys on the client IP", func(t *testing.T) {
+		rl := middleware.NewPolicyRateLimiter()
+		require.NoError(t, rl.Reload(policies))
+		require.NoError(t, call(rl, "random-1"))
+		assert.Equal(t, codes.ResourceExhausted, status.Code(call(rl, "random-2")))
+	})
+
+	t.Run("Should key verified API keys on the key", func(t *testing.T) {
+		rl := middleware.NewPolicyRateLimiter().WithAPIKeyVerifier(func(_ context.Context, key string) (string, error) {
+			if key == "forged" {
+				return "", errors.New("unknown API key")
+			}
+			return key, nil
+		})
+		require.NoError(t, rl.Reload(policies))
+		require.NoError(t, call(rl, "key-1"))
+		require.NoError(t, call(rl, "key-2"))
+		assert.Equal(t, codes.ResourceExhausted, status.Code(call(rl, "key-1")))
+		assert.NoError(t, call(rl, "forged"), "Should fall back to the IP bucket")
+		assert.Equal(t, codes.ResourceExhausted, status.Code(call(rl, "forged")))
+	})
+}
@@ -0,0 +1,196 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// defaultRedisRateLimitPrefix namespaces the rate limit keys
+const defaultRedisRateLimitPrefix = "ratelimit:"
+
+// The scripts use the Redis clock so every replica sees the same time.
+// They all return {allowed, remaining, retry_after_ms, reset_after_ms}.
+//
+//nolint:gochecknoglobals // scripts are loaded once and cached by SHA
+var (
+	// fixedWindowScript increments the window counter and starts its expiry on the first hit.
+	// ARGV: rate, window_ms
+	fixedWindowScript = goredis.NewScript(`
+local rate = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local count = redis.call('INCR', KEYS[1])
+if count == 1 then
+	redis.call('PEXPIRE', KEYS[1], window)
+end
+local ttl = redis.call('PTTL', KEYS[1])
+if ttl < 0 then
+	redis.call('PEXPIRE', KEYS[1], window)
+	ttl = window
+end
+if count > rate then
+	return {0, 0, ttl, ttl}
+end
+return {1, rate - count, 0, ttl}
+`)
+
+	// tokenBucketScript refills rate tokens per window continuously up to burst.
+	// ARGV: rate, window_ms, burst
+	tokenBucketScript = goredis.NewScript(`
+local rate = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local burst = tonumber(ARGV[3])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local refill = rate / window
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+elseif now > ts then
+	tokens = math.min(burst, tokens + (now - ts) * refill)
+end
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	retry = math.ceil((1 - tokens) / refill)
+end
+local reset = math.ceil((burst - tokens) / refill)
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.max(reset, 1))
+return {allowed, math.floor(tokens), retry, reset}
+`)
+
+	// gcraScript stores the theoretical arrival time of the next request.
+	// ARGV: rate, window_ms, burst
+	gcraScript = goredis.NewScript(`
+local rate = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local burst = tonumber(ARGV[3])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local interval = window / rate
+local tolerance = interval * burst
+local tat = tonumber(redis.call('GET', KEYS[1]))
+if tat == nil or tat < now then
+	tat = now
+end
+local new_tat = tat + interval
+local allow_at = new_tat - tolerance
+if now < allow_at then
+	return {0, 0, math.ceil(allow_at - now), math.ceil(tat - now)}
+end
+local reset = math.ceil(new_tat - now)
+redis.call('SET', KEYS[1], tostring(new_tat), 'PX', math.max(reset, 1))
+return {1, math.floor((now - allow_at) / interval), 0, reset}
+`)
+
+	// slidingWindowScript weights the previous aligned window by its overlap with the sliding window.
+	// ARGV: rate, window_ms
+	slidingWindowScript = goredis.NewScript(`
+local rate = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local index = math.floor(now / window)
+local elapsed = now - index * window
+local state = redis.call('HMGET', KEYS[1], 'index', 'count', 'prev')
+local stored = tonumber(state[1])
+local count = tonumber(state[2]) or 0
+local prev = tonumber(state[3]) or 0
+if stored == index - 1 then
+	prev = count
+	count = 0
+elseif stored ~= index then
+	prev = 0
+	count = 0
+end
+local estimate = prev * (window - elapsed) / window + count
+local allowed = 0
+local retry = 0
+if estimate + 1 > rate then
+	if count + 1 > rate then
+		retry = (window - elapsed) + math.ceil(window * (1 - (rate - 1) / count))
+	else
+		retry = math.ceil(window * (1 - (rate - 1 - count) / prev)) - elapsed
+	end
+else
+	count = count + 1
+	estimate = estimate + 1
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'index', tostring(index), 'count', count, 'prev', prev)
+redis.call('PEXPIRE', KEYS[1], 2 * window)
+local reset = window - elapsed
+if count > 0 then
+	reset = reset + window
+end
+return {allowed, math.max(math.floor(rate - estimate), 0), retry, reset}
+`)
+)
+
+// RedisRateLimitStore shares counters between replicas through Redis, every check is one atomic script
+type RedisRateLimitStore struct {
+	client goredis.Scripter
+	prefix string
+}
+
+// NewRedisRateLimitStore creates a store on client, e.g. NewRedisRateLimitStore(redis.GetClient())
+func NewRedisRateLimitStore(client goredis.Scripter) *RedisRateLimitStore {
+	return &RedisRateLimitStore{client: client, prefix: defaultRedisRateLimitPrefix}
+}
+
+// WithPrefix overrides the key prefix, useful when several services share a Redis
+func (s *RedisRateLimitStore) WithPrefix(prefix string) *RedisRateLimitStore {
+	s.prefix = prefix
+	return s
+}
+
+// Allow consumes one request for key with the algorithm of limit
+func (s *RedisRateLimitStore) Allow(ctx context.Context, key string, limit Limit) (RateLimitResult, error) {
+	if !limit.valid() {
+		return RateLimitResult{RetryAfter: limit.Window, ResetAfter: limit.Window}, nil
+	}
+
+	script := fixedWindowScript
+	args := []any{limit.Rate, limit.Window.Milliseconds()}
+	switch limit.Algorithm {
+	case AlgorithmTokenBucket:
+		script = tokenBucketScript
+		args = append(args, limit.burst())
+	case AlgorithmGCRA:
+		script = gcraScript
+		args = append(args, limit.burst())
+	case AlgorithmSlidingWindow:
+		script = slidingWindowScript
+	}
+
+	// the algorithm is part of the key so a policy change never reads a foreign state
+	redisKey := s.prefix + string(limit.algorithm()) + ":" + key
+	res, err := script.Run(ctx, s.client, []string{redisKey}, args...).Int64Slice()
+	if err != nil {
+		return RateLimitResult{}, fmt.Errorf("failed to check rate limit: %w", err)
+	}
+	if len(res) != 4 {
+		return RateLimitResult{}, fmt.Errorf("unexpected rate limit script result: %v", res)
+	}
+
+	limitValue := limit.Rate
+	if limit.Algorithm == AlgorithmTokenBucket || limit.Algorithm == AlgorithmGCRA {
+		limitValue = limit.burst()
+	}
+
+	return RateLimitResult{
+		Allowed:    res[0] == 1,
+		Limit:      limitValue,
+		Remaining:  int(res[1]),
+		RetryAfter: time.Duration(res[2]) * time.Millisecond,
+		ResetAfter: time.Duration(res[3]) * time.Millisecond,
+	}, nil
+}
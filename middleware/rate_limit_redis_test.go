@@ -0,0 +1,76 @@
+package middleware_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cozy-hub-app/framework/middleware"
+)
+
+// newMiniredis starts an in-process Redis with a fixed clock
+func newMiniredis(t *testing.T) (*miniredis.Miniredis, *goredis.Client) {
+	t.Helper()
+	m := miniredis.RunT(t)
+	m.SetTime(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	client := goredis.NewClient(&goredis.Options{Addr: m.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return m, client
+}
+
+func TestRedisRateLimitStore(t *testing.T) {
+	ctx := context.Background()
+	m, client := newMiniredis(t)
+	store := middleware.NewRedisRateLimitStore(client)
+	limit := middleware.Limit{Rate: 2, Window: time.Minute}
+
+	for i := 1; i >= 0; i-- {
+		res, err := store.Allow(ctx, "ip:198.51.100.1", limit)
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, i, res.Remaining)
+		assert.Equal(t, 2, res.Limit)
+	}
+
+	res, err := store.Allow(ctx, "ip:198.51.100.1", limit)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, time.Minute, res.RetryAfter)
+
+	t.Run("Should prefix the keys", func(t *testing.T) {
+		assert.True(t, m.Exists("ratelimit:fixed_window:ip:198.51.100.1"))
+
+		_, err := middleware.NewRedisRateLimitStore(client).WithPrefix("cart:").Allow(ctx, "ip:198.51.100.1", limit)
+		require.NoError(t, err)
+		assert.True(t, m.Exists("cart:fixed_window:ip:198.51.100.1"))
+	})
+
+	t.Run("Should reset once the key expires", func(t *testing.T) {
+		m.FastForward(time.Minute)
+		assert.False(t, m.Exists("ratelimit:fixed_window:ip:198.51.100.1"))
+
+		res, err := store.Allow(ctx, "ip:198.51.100.1", limit)
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, 1, res.Remaining)
+	})
+
+	t.Run("Should deny invalid limits without Redis", func(t *testing.T) {
+		res, err := store.Allow(ctx, "ip:198.51.100.1", middleware.Limit{Window: time.Minute})
+		require.NoError(t, err)
+		assert.False(t, res.Allowed)
+	})
+
+	t.Run("Should report Redis errors", func(t *testing.T) {
+		m.SetError("LOADING")
+		t.Cleanup(func() { m.SetError("") })
+		_, err := store.Allow(ctx, "ip:198.51.100.1", limit)
+		assert.Error(t, err)
+	})
+}
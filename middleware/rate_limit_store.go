@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// FailurePolicy decides what happens to a request when the rate limit store is unavailable
+type FailurePolicy int
+
+const (
+	// FailOpen lets requests through when the store errors
+	FailOpen FailurePolicy = iota
+	// FailClosed rejects requests with codes.Unavailable when the store errors
+	FailClosed
+)
+
+// Limit is the number of requests allowed per window
+type Limit struct {
+	Rate int
+	// Window is at least a millisecond, the precision of the Redis store
+	Window time.Duration
+	// Algorithm defaults to AlgorithmFixedWindow
+	Algorithm Algorithm
+	// Burst is the bucket capacity of AlgorithmTokenBucket and AlgorithmGCRA, defaults to Rate
+	Burst int
+}
+
+// RateLimitResult is the outcome of a rate limit check
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// RetryAfter is how long a denied caller should wait, 0 when allowed
+	RetryAfter time.Duration
+	// ResetAfter is how long until the quota is fully restored
+	ResetAfter time.Duration
+}
+
+// RateLimitStore keeps the rate limit state of every key.
+// Implementations must be safe for concurrent use and atomic per key.
+type RateLimitStore interface {
+	// Allow consumes one request for key under limit
+	Allow(ctx context.Context, key string, limit Limit) (RateLimitResult, error)
+}
+
+// MemoryRateLimitStore keeps counters in the process, limits are per replica
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	states    map[string]*memoryRateState
+	lastSweep time.Time
+}
+
+type memoryRateState struct {
+	rateState
+	expires time.Time
+}
+
+// memorySweepInterval bounds how often expired states are removed
+const memorySweepInterval = time.Minute
+
+// NewMemoryRateLimitStore creates an in-memory store, expired entries are swept lazily
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		states:    make(map[string]*memoryRateState),
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow consumes one request for key with the algorithm of limit
+func (s *MemoryRateLimitStore) Allow(_ context.Context, key string, limit Limit) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	state, ok := s.states[key]
+	if !ok {
+		state = &memoryRateState{}
+		s.states[key] = state
+	}
+
+	result := state.allow(now, limit)
+	state.expires = state.expiresAt(limit)
+	return result, nil
+}
+
+// sweep drops expired states, the caller must hold the lock
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < memorySweepInterval {
+		return
+	}
+	s.lastSweep = now
+
+	for key, state := range s.states {
+		if now.After(state.expires) {
+			delete(s.states, key)
+		}
+	}
+}
+
+// fixedWindowResult builds the result of the count-th request of a window resetting in resetAfter
+func fixedWindowResult(count int, limit Limit, resetAfter time.Duration) RateLimitResult {
+	result := RateLimitResult{
+		Allowed:    count <= limit.Rate,
+		Limit:      limit.Rate,
+		Remaining:  max(limit.Rate-count, 0),
+		ResetAfter: resetAfter,
+	}
+	if !result.Allowed {
+		result.RetryAfter = resetAfter
+	}
+	return result
+}
@@ -3,198 +3,173 @@ package middleware
 import (
 	"context"
 	"fmt"
-	"strings"
-	"sync"
+	"strconv"
 	"time"
 
+	"github.com/cozy-hub-app/framework/logger"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
 
-// RateLimiter implements token bucket rate limiting
-type RateLimiter struct {
-	limiters map[string]*bucket
-	mu       sync.RWMutex
-	rate     int           // requests per window
-	window   time.Duration // time window
-	cleanup  time.Duration // cleanup interval
-}
+// rate limit metadata keys, exposed as X-RateLimit-* and Retry-After by the gateway
+const (
+	mdRateLimitLimit     = "x-ratelimit-limit"
+	mdRateLimitRemaining = "x-ratelimit-remaining"
+	mdRateLimitReset     = "x-ratelimit-reset"
+	mdRetryAfter         = "retry-after"
+)
 
-type bucket struct {
-	tokens     int
-	lastRefill time.Time
-	mu         sync.Mutex
+// RateLimiter enforces a Limit per caller and method on top of a RateLimitStore
+type RateLimiter struct {
+	store         RateLimitStore
+	limit         Limit
+	failurePolicy FailurePolicy
 }
 
-// NewRateLimiter creates a new rate limiter
+// NewRateLimiter creates a new fixed window rate limiter backed by an in-memory store
 // rate: maximum number of requests per window
 // window: time window for rate limiting (e.g., 15 minutes)
 func NewRateLimiter(rate int, window time.Duration) *RateLimiter {
-	rl := &RateLimiter{
-		limiters: make(map[string]*bucket),
-		rate:     rate,
-		window:   window,
-		cleanup:  window * 2, // cleanup stale entries
-	}
+	return NewRateLimiterWithLimit(Limit{Rate: rate, Window: window})
+}
 
-	// Start cleanup goroutine
-	go rl.cleanupRoutine()
+// NewRateLimiterWithLimit creates a rate limiter with any algorithm, e.g.
+// NewRateLimiterWithLimit(Limit{Rate: 10, Window: time.Second, Burst: 20, Algorithm: AlgorithmTokenBucket})
+func NewRateLimiterWithLimit(limit Limit) *RateLimiter {
+	return &RateLimiter{
+		store: NewMemoryRateLimitStore(),
+		limit: limit,
+	}
+}
 
+// WithStore replaces the in-memory store, e.g. with a RedisRateLimitStore shared by every replica
+func (rl *RateLimiter) WithStore(store RateLimitStore) *RateLimiter {
+	rl.store = store
 	return rl
 }
 
-// cleanupRoutine periodically removes stale rate limit entries
-func (rl *RateLimiter) cleanupRoutine() {
-	ticker := time.NewTicker(rl.cleanup)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		rl.mu.Lock()
-		now := time.Now()
-		for key, b := range rl.limiters {
-			b.mu.Lock()
-			if now.Sub(b.lastRefill) > rl.cleanup {
-				delete(rl.limiters, key)
-			}
-			b.mu.Unlock()
-		}
-		rl.mu.Unlock()
-	}
+// WithFailurePolicy sets the behavior when the store errors, FailOpen by default
+func (rl *RateLimiter) WithFailurePolicy(policy FailurePolicy) *RateLimiter {
+	rl.failurePolicy = policy
+	return rl
 }
 
-// getBucket returns or creates a bucket for the given key
-func (rl *RateLimiter) getBucket(key string) *bucket {
-	rl.mu.RLock()
-	b, exists := rl.limiters[key]
-	rl.mu.RUnlock()
+// UnaryServerInterceptor returns a gRPC unary server interceptor for rate limiting
+func (rl *RateLimiter) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		if err := rl.check(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
 
-	if exists {
-		return b
+		// Continue with request
+		return handler(ctx, req)
 	}
+}
 
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
-
-	// Double-check after acquiring write lock
-	if b, exists := rl.limiters[key]; exists {
-		return b
-	}
+// StreamServerInterceptor returns a gRPC stream server interceptor for rate limiting,
+// each stream counts as one request
+func (rl *RateLimiter) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		if err := rl.check(ss.Context(), info.FullMethod); err != nil {
+			return err
+		}
 
-	b = &bucket{
-		tokens:     rl.rate,
-		lastRefill: time.Now(),
+		// Continue with stream
+		return handler(srv, ss)
 	}
-	rl.limiters[key] = b
-	return b
 }
 
-// allow checks if a request should be allowed
-func (rl *RateLimiter) allow(key string) bool {
-	b := rl.getBucket(key)
-	b.mu.Lock()
-	defer b.mu.Unlock()
-
-	now := time.Now()
-	elapsed := now.Sub(b.lastRefill)
-
-	// Refill bucket if window has passed
-	if elapsed >= rl.window {
-		b.tokens = rl.rate
-		b.lastRefill = now
+// check consumes a token for the caller of method and returns a gRPC error when denied
+func (rl *RateLimiter) check(ctx context.Context, method string) error {
+	// Extract identifier (IP or user ID)
+	// SECURITY: Reject requests that cannot be identified to prevent rate limit bypass
+	identifier, err := ExtractIdentifierForRateLimit(ctx)
+	if err != nil {
+		return status.Errorf(
+			codes.FailedPrecondition,
+			"unable to identify client for rate limiting: %v", err,
+		)
 	}
 
-	// Check if tokens available
-	if b.tokens > 0 {
-		b.tokens--
-		return true
-	}
+	key := fmt.Sprintf("%s:%s", method, identifier)
+	return enforceLimit(ctx, rl.store, rl.failurePolicy, key, rl.limit, rateLimitLabels{method: method})
+}
 
-	return false
+// rateLimitLabels are the labels of rate_limit_exceeded_total
+type rateLimitLabels struct {
+	method string
+	policy string
+	key    string
+	tier   string
 }
 
-// extractIdentifier extracts IP address or user identifier from context
-// SECURITY: Returns error instead of fallback to prevent rate limit bypass
-// where all unidentified users would share the same bucket ("ip:unknown")
-func extractIdentifier(ctx context.Context) (string, error) {
-	// PRIORITY 1: Try to get user ID from metadata (set by auth middleware)
-	// This is the most reliable identifier for authenticated requests
-	if md, ok := metadata.FromIncomingContext(ctx); ok {
-		if userIDs := md.Get("user_id"); len(userIDs) > 0 && userIDs[0] != "" {
-			return fmt.Sprintf("user:%s", userIDs[0]), nil
+// enforceLimit consumes one request of key and returns a gRPC error when denied.
+// The quota is reported in the response headers, or in the trailers of the denial.
+func enforceLimit(
+	ctx context.Context,
+	store RateLimitStore,
+	failurePolicy FailurePolicy,
+	key string,
+	limit Limit,
+	labels rateLimitLabels,
+) error {
+	result, err := store.Allow(ctx, key, limit)
+	if err != nil {
+		if failurePolicy == FailClosed {
+			logger.FromContext(ctx).Error("rate limit store unavailable, rejecting request", "error", err)
+			return status.Error(codes.Unavailable, "rate limiter unavailable")
 		}
+		logger.FromContext(ctx).Warn("rate limit store unavailable, allowing request", "error", err)
+		return nil
 	}
 
-	// PRIORITY 2: Try to get user ID from context (legacy support)
-	if userID, ok := ctx.Value("user_id").(string); ok && userID != "" {
-		return fmt.Sprintf("user:%s", userID), nil
-	}
+	if !result.Allowed {
+		rateLimitExceeded.WithLabelValues(labels.method, labels.policy, labels.key, labels.tier).Inc()
 
-	// PRIORITY 3: Get IP address from trusted headers
-	// Note: X-Forwarded-For can be spoofed, so we only use X-Real-IP from trusted proxy
-	if md, ok := metadata.FromIncomingContext(ctx); ok {
-		// X-Real-IP is set by trusted reverse proxies (nginx, cloudflare)
-		// This is more reliable than X-Forwarded-For for rate limiting
-		if xrip := md.Get("x-real-ip"); len(xrip) > 0 && xrip[0] != "" {
-			return fmt.Sprintf("ip:%s", xrip[0]), nil
-		}
+		// trailers travel with the error status, the gateway turns them into HTTP headers
+		md := rateLimitMetadata(result)
+		md.Set(mdRetryAfter, strconv.FormatInt(ceilSeconds(result.RetryAfter), 10))
+		_ = grpc.SetTrailer(ctx, md)
 
-		// Fallback to X-Forwarded-For first IP (client IP)
-		// Note: This can be spoofed, but better than nothing for unauthenticated requests
-		if xff := md.Get("x-forwarded-for"); len(xff) > 0 && xff[0] != "" {
-			// X-Forwarded-For format: "client, proxy1, proxy2"
-			// We only want the first IP (client IP)
-			clientIP := strings.Split(xff[0], ",")[0]
-			clientIP = strings.TrimSpace(clientIP)
-			if clientIP != "" {
-				return fmt.Sprintf("ip:%s", clientIP), nil
-			}
-		}
+		return status.Errorf(
+			codes.ResourceExhausted,
+			"rate limit exceeded: maximum %d requests per %v",
+			limit.Rate,
+			limit.Window,
+		)
 	}
 
-	// SECURITY: No fallback to "ip:unknown" - reject request instead
-	// This prevents all unidentified users from sharing the same rate limit bucket
-	// In production, ALL requests should have either user_id or IP from proxy
-	return "", fmt.Errorf("unable to identify client: no user_id or IP address found")
+	_ = grpc.SetHeader(ctx, rateLimitMetadata(result))
+	return nil
 }
 
-// UnaryServerInterceptor returns a gRPC unary server interceptor for rate limiting
-func (rl *RateLimiter) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
-	return func(
-		ctx context.Context,
-		req interface{},
-		info *grpc.UnaryServerInfo,
-		handler grpc.UnaryHandler,
-	) (interface{}, error) {
-		// Extract identifier (IP or user ID)
-		// SECURITY: Reject requests that cannot be identified to prevent rate limit bypass
-		identifier, err := extractIdentifier(ctx)
-		if err != nil {
-			return nil, status.Errorf(
-				codes.FailedPrecondition,
-				"unable to identify client for rate limiting: %v", err,
-			)
-		}
-
-		key := fmt.Sprintf("%s:%s", info.FullMethod, identifier)
-
-		// Check rate limit
-		if !rl.allow(key) {
-			return nil, status.Errorf(
-				codes.ResourceExhausted,
-				"rate limit exceeded: maximum %d requests per %v",
-				rl.rate,
-				rl.window,
-			)
-		}
+// rateLimitMetadata reports the quota of the caller
+func rateLimitMetadata(result RateLimitResult) metadata.MD {
+	return metadata.Pairs(
+		mdRateLimitLimit, strconv.Itoa(result.Limit),
+		mdRateLimitRemaining, strconv.Itoa(result.Remaining),
+		mdRateLimitReset, strconv.FormatInt(ceilSeconds(result.ResetAfter), 10),
+	)
+}
 
-		// Continue with request
-		return handler(ctx, req)
-	}
+// ceilSeconds rounds a duration up to whole seconds
+func ceilSeconds(d time.Duration) int64 {
+	return int64((d + time.Second - 1) / time.Second)
 }
 
-// MethodRateLimiter allows different rate limits for different methods
+// MethodRateLimiter allows different rate limits for different methods, all sharing one store
 type MethodRateLimiter struct {
 	limiters map[string]*RateLimiter
 	default_ *RateLimiter
@@ -208,9 +183,37 @@ func NewMethodRateLimiter(defaultRate int, defaultWindow time.Duration) *MethodR
 	}
 }
 
-// AddMethodLimit adds a specific rate limit for a method
+// WithStore replaces the store of the default and every method limit
+func (mrl *MethodRateLimiter) WithStore(store RateLimitStore) *MethodRateLimiter {
+	mrl.default_.WithStore(store)
+	for _, rl := range mrl.limiters {
+		rl.WithStore(store)
+	}
+	return mrl
+}
+
+// WithFailurePolicy sets the behavior of the default and every method limit when the store errors
+func (mrl *MethodRateLimiter) WithFailurePolicy(policy FailurePolicy) *MethodRateLimiter {
+	mrl.default_.WithFailurePolicy(policy)
+	for _, rl := range mrl.limiters {
+		rl.WithFailurePolicy(policy)
+	}
+	return mrl
+}
+
+// AddMethodLimit adds a specific fixed window rate limit for a method,
+// sharing the store and policy of the default limit
 func (mrl *MethodRateLimiter) AddMethodLimit(method string, rate int, window time.Duration) {
-	mrl.limiters[method] = NewRateLimiter(rate, window)
+	mrl.AddMethodLimitWithLimit(method, Limit{Rate: rate, Window: window})
+}
+
+// AddMethodLimitWithLimit adds a specific rate limit for a method with any algorithm
+func (mrl *MethodRateLimiter) AddMethodLimitWithLimit(method string, limit Limit) {
+	mrl.limiters[method] = &RateLimiter{
+		store:         mrl.default_.store,
+		limit:         limit,
+		failurePolicy: mrl.default_.failurePolicy,
+	}
 }
 
 // UnaryServerInterceptor returns a gRPC unary server interceptor
@@ -221,35 +224,36 @@ func (mrl *MethodRateLimiter) UnaryServerInterceptor() grpc.UnaryServerIntercept
 		info *grpc.UnaryServerInfo,
 		handler grpc.UnaryHandler,
 	) (interface{}, error) {
-		// Get rate limiter for this method
-		limiter := mrl.default_
-		if methodLimiter, exists := mrl.limiters[info.FullMethod]; exists {
-			limiter = methodLimiter
+		if err := mrl.limiterFor(info.FullMethod).check(ctx, info.FullMethod); err != nil {
+			return nil, err
 		}
 
-		// Extract identifier
-		// SECURITY: Reject requests that cannot be identified to prevent rate limit bypass
-		identifier, err := extractIdentifier(ctx)
-		if err != nil {
-			return nil, status.Errorf(
-				codes.FailedPrecondition,
-				"unable to identify client for rate limiting: %v", err,
-			)
-		}
-
-		key := fmt.Sprintf("%s:%s", info.FullMethod, identifier)
+		// Continue with request
+		return handler(ctx, req)
+	}
+}
 
-		// Check rate limit
-		if !limiter.allow(key) {
-			return nil, status.Errorf(
-				codes.ResourceExhausted,
-				"rate limit exceeded: maximum %d requests per %v",
-				limiter.rate,
-				limiter.window,
-			)
+// StreamServerInterceptor returns a gRPC stream server interceptor
+func (mrl *MethodRateLimiter) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		if err := mrl.limiterFor(info.FullMethod).check(ss.Context(), info.FullMethod); err != nil {
+			return err
 		}
 
-		// Continue with request
-		return handler(ctx, req)
+		// Continue with stream
+		return handler(srv, ss)
+	}
+}
+
+// limiterFor returns the rate limiter configured for the method or the default one
+func (mrl *MethodRateLimiter) limiterFor(method string) *RateLimiter {
+	if methodLimiter, exists := mrl.limiters[method]; exists {
+		return methodLimiter
 	}
+	return mrl.default_
 }
@@ -0,0 +1,110 @@
+package middleware_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/cozy-hub-app/framework/middleware"
+)
+
+type failingStore struct{}
+
+func (failingStore) Allow(context.Context, string, middleware.Limit) (middleware.RateLimitResult, error) {
+	return middleware.RateLimitResult{}, errors.New("connection refused")
+}
+
+func callRateLimited(rl *middleware.RateLimiter, ip string) error {
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 1}})
+	info := &grpc.UnaryServerInfo{FullMethod: "/cart.CartService/Get"}
+	_, err := rl.UnaryServerInterceptor()(ctx, nil, info, func(context.Context, interface{}) (interface{}, error) {
+		return nil, nil
+	})
+	return err
+}
+
+func TestMemoryRateLimitStore(t *testing.T) {
+	store := middleware.NewMemoryRateLimitStore()
+	limit := middleware.Limit{Rate: 2, Window: time.Minute}
+
+	for i, want := range []int{1, 0} {
+		res, err := store.Allow(context.Background(), "key", limit)
+		require.NoError(t, err)
+		assert.True(t, res.Allowed, "request %d", i)
+		assert.Equal(t, want, res.Remaining)
+	}
+
+	res, err := store.Allow(context.Background(), "key", limit)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Positive(t, res.RetryAfter)
+
+	res, err = store.Allow(context.Background(), "other", limit)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed, "Should count keys independently")
+}
+
+func TestRateLimiterFailurePolicy(t *testing.T) {
+	t.Run("Should allow when failing open", func(t *testing.T) {
+		rl := middleware.NewRateLimiter(1, time.Minute).WithStore(failingStore{})
+		assert.NoError(t, callRateLimited(rl, "198.51.100.1"))
+	})
+
+	t.Run("Should reject when failing closed", func(t *testing.T) {
+		rl := middleware.NewRateLimiter(1, time.Minute).
+			WithStore(failingStore{}).
+			WithFailurePolicy(middleware.FailClosed)
+		assert.Equal(t, codes.Unavailable, status.Code(callRateLimited(rl, "198.51.100.1")))
+	})
+
+	t.Run("Should reject over the limit", func(t *testing.T) {
+		rl := middleware.NewRateLimiter(1, time.Minute)
+		require.NoError(t, callRateLimited(rl, "198.51.100.1"))
+		assert.Equal(t, codes.ResourceExhausted, status.Code(callRateLimited(rl, "198.51.100.1")))
+	})
+}
+
+func TestMemoryRateLimitStoreAlgorithms(t *testing.T) {
+	tests := []struct {
+		name    string
+		limit   middleware.Limit
+		allowed int
+	}{
+		{name: "Should allow the burst of a token bucket",
+			limit:   middleware.Limit{Rate: 1, Window: time.Hour, Burst: 3, Algorithm: middleware.AlgorithmTokenBucket},
+			allowed: 3},
+		{name: "Should allow the burst of a GCRA",
+			limit:   middleware.Limit{Rate: 1, Window: time.Hour, Burst: 3, Algorithm: middleware.AlgorithmGCRA},
+			allowed: 3},
+		{name: "Should allow the rate of a sliding window",
+			limit:   middleware.Limit{Rate: 2, Window: time.Hour, Algorithm: middleware.AlgorithmSlidingWindow},
+			allowed: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := middleware.NewMemoryRateLimitStore()
+			for i := 0; i < tt.allowed; i++ {
+				res, err := store.Allow(context.Background(), "key", tt.limit)
+				require.NoError(t, err)
+				require.True(t, res.Allowed, "request %d", i)
+				assert.Equal(t, tt.allowed-i-1, res.Remaining)
+			}
+
+			res, err := store.Allow(context.Background(), "key", tt.limit)
+			require.NoError(t, err)
+			assert.False(t, res.Allowed)
+			assert.Zero(t, res.Remaining)
+			assert.Positive(t, res.RetryAfter)
+			assert.LessOrEqual(t, res.RetryAfter, 2*time.Hour)
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+// serverStream overrides the context of a grpc.ServerStream so stream interceptors
+// can enrich it like unary interceptors do
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the enriched context
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// wrapServerStream returns ss with ctx as its context
+func wrapServerStream(ss grpc.ServerStream, ctx context.Context) grpc.ServerStream {
+	if ctx == ss.Context() {
+		return ss
+	}
+	return &serverStream{ServerStream: ss, ctx: ctx}
+}
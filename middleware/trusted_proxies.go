@@ -0,0 +1,244 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+
+	"github.com/cozy-hub-app/framework/env"
+	"github.com/cozy-hub-app/framework/logger"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// loopbackProxies are always trusted: the gateway proxies to the gRPC server over loopback
+//
+//nolint:gochecknoglobals // constant prefixes
+var loopbackProxies = []netip.Prefix{
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("::1/128"),
+}
+
+//nolint:gochecknoglobals // process wide trusted proxies, loaded from env on first use
+var (
+	_trustedProxies     *TrustedProxies
+	_trustedProxiesOnce sync.Once
+	_trustedProxiesMu   sync.RWMutex
+)
+
+// ProxyHeader is the header the trusted proxies set, the only one read by ClientIP
+type ProxyHeader string
+
+const (
+	// ProxyHeaderXForwardedFor is the comma-separated chain appended to by each proxy, the default
+	ProxyHeaderXForwardedFor ProxyHeader = "x-forwarded-for"
+	// ProxyHeaderForwarded is the RFC 7239 Forwarded header, read from its for= parameters
+	ProxyHeaderForwarded ProxyHeader = "forwarded"
+	// ProxyHeaderXRealIP is a single address, only safe when the proxy overwrites it.
+	// The gateway overwrites it with the HTTP peer unless the peer is a trusted proxy.
+	ProxyHeaderXRealIP ProxyHeader = "x-real-ip"
+)
+
+// ParseProxyHeader parses a proxy header name, empty defaults to ProxyHeaderXForwardedFor
+func ParseProxyHeader(name string) (ProxyHeader, error) {
+	switch header := ProxyHeader(strings.ToLower(strings.TrimSpace(name))); header {
+	case "":
+		return ProxyHeaderXForwardedFor, nil
+	case ProxyHeaderXForwardedFor, ProxyHeaderForwarded, ProxyHeaderXRealIP:
+		return header, nil
+	default:
+		return "", fmt.Errorf("unknown trusted proxy header %q", name)
+	}
+}
+
+// TrustedProxies resolves the client IP from proxy headers, honoring them only when they
+// were appended by a proxy inside one of the trusted networks
+type TrustedProxies struct {
+	prefixes []netip.Prefix
+	header   ProxyHeader
+}
+
+// ParseTrustedProxies parses CIDRs (or bare IPs) of trusted proxies, loopback is always included
+func ParseTrustedProxies(cidrs ...string) (*TrustedProxies, error) {
+	prefixes := append([]netip.Prefix{}, loopbackProxies...)
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+
+		if !strings.Contains(cidr, "/") {
+			addr, err := netip.ParseAddr(cidr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", cidr, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", cidr, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	return &TrustedProxies{prefixes: prefixes, header: ProxyHeaderXForwardedFor}, nil
+}
+
+// WithHeader selects the header set by the trusted proxies, other proxy headers are
+// client-controlled and ignored
+func (t *TrustedProxies) WithHeader(header ProxyHeader) *TrustedProxies {
+	t.header = header
+	return t
+}
+
+// TrustedProxiesFromEnv parses the comma-separated TRUSTED_PROXIES environment variable and
+// TRUSTED_PROXY_HEADER (x-forwarded-for, forwarded or x-real-ip)
+func TrustedProxiesFromEnv() (*TrustedProxies, error) {
+	header, err := ParseProxyHeader(env.Get(env.TrustedProxyHeader))
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := ParseTrustedProxies(env.GetList(env.TrustedProxies)...)
+	if err != nil {
+		return nil, err
+	}
+	return t.WithHeader(header), nil
+}
+
+// SetTrustedProxies replaces the process wide trusted proxies used by ExtractClientIP
+func SetTrustedProxies(t *TrustedProxies) {
+	_trustedProxiesOnce.Do(func() {})
+	_trustedProxiesMu.Lock()
+	defer _trustedProxiesMu.Unlock()
+	_trustedProxies = t
+}
+
+// GetTrustedProxies returns the process wide trusted proxies, loaded from env on first use.
+// An invalid TRUSTED_PROXIES is logged and only loopback is trusted.
+func GetTrustedProxies() *TrustedProxies {
+	_trustedProxiesOnce.Do(func() {
+		t, err := TrustedProxiesFromEnv()
+		if err != nil {
+			logger.RestrictedGet().Error("ignoring invalid TRUSTED_PROXIES", "error", err)
+			t, _ = ParseTrustedProxies()
+		}
+		_trustedProxies = t
+	})
+
+	_trustedProxiesMu.RLock()
+	defer _trustedProxiesMu.RUnlock()
+	return _trustedProxies
+}
+
+// Contains reports whether addr belongs to a trusted network
+func (t *TrustedProxies) Contains(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range t.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP resolves the client address of a gRPC call.
+// The proxy header is only considered when the transport peer is trusted, and only the configured
+// one is read: a proxy that appends X-Forwarded-For passes a client-supplied Forwarded through.
+// The forwarding chain is walked right-to-left past trusted hops and the first untrusted hop is
+// the client. The peer address is the fallback.
+func (t *TrustedProxies) ClientIP(ctx context.Context) (netip.Addr, error) {
+	peerAddr, hasPeer := peerAddr(ctx)
+	if !hasPeer {
+		return netip.Addr{}, ErrIPNotFound
+	}
+	if !t.Contains(peerAddr) {
+		return peerAddr, nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(string(t.header))
+
+	var chain []string
+	switch t.header {
+	case ProxyHeaderForwarded:
+		chain = forwardedFor(values)
+	case ProxyHeaderXRealIP:
+		// a single address set by the proxy, the last value wins if it was appended
+		if len(values) > 0 {
+			chain = values[len(values)-1:]
+		}
+	default:
+		chain = strings.Split(strings.Join(values, ","), ",")
+	}
+
+	client := peerAddr
+	for i := len(chain) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(chain[i])
+		if hop == "" {
+			continue
+		}
+
+		addr, ok := parseHop(hop)
+		if !ok {
+			// obfuscated or malformed hop: the nearest trusted hop is the best we know
+			return client, nil
+		}
+		if !t.Contains(addr) {
+			return addr, nil
+		}
+		client = addr
+	}
+
+	return client, nil
+}
+
+// peerAddr returns the transport address of the gRPC peer
+func peerAddr(ctx context.Context) (netip.Addr, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return netip.Addr{}, false
+	}
+
+	addr, ok := parseHop(p.Addr.String())
+	return addr, ok
+}
+
+// forwardedFor extracts the for= parameters of RFC 7239 Forwarded header values, in order
+func forwardedFor(values []string) []string {
+	var chain []string
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				name, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(name, "for") {
+					chain = append(chain, strings.Trim(val, `"`))
+				}
+			}
+		}
+	}
+	return chain
+}
+
+// parseHop parses an address with an optional port, IPv6 may be bracketed ("[2001:db8::1]:4711")
+func parseHop(hop string) (netip.Addr, bool) {
+	if addr, err := netip.ParseAddr(hop); err == nil {
+		return addr.Unmap(), true
+	}
+
+	host, _, err := net.SplitHostPort(hop)
+	if err != nil {
+		host = strings.TrimSuffix(strings.TrimPrefix(hop, "["), "]")
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
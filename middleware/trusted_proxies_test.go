@@ -0,0 +1,62 @@
+package middleware_test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+
+	"github.com/cozy-hub-app/framework/middleware"
+)
+
+func TestTrustedProxiesClientIP(t *testing.T) {
+	proxies, err := middleware.ParseTrustedProxies("10.0.0.0/8", "2001:db8::1")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		header middleware.ProxyHeader
+		peer   string
+		md     []string
+		want   string
+	}{
+		{name: "Should ignore headers from an untrusted peer", peer: "203.0.113.7",
+			md: []string{"x-forwarded-for", "198.51.100.1"}, want: "203.0.113.7"},
+		{name: "Should fallback to the trusted peer", peer: "10.0.0.2", want: "10.0.0.2"},
+		{name: "Should skip trusted hops right-to-left", peer: "127.0.0.1",
+			md: []string{"x-forwarded-for", "1.1.1.1, 198.51.100.1, 10.0.0.3"}, want: "198.51.100.1"},
+		{name: "Should ignore a forged Forwarded header behind an X-Forwarded-For proxy", peer: "10.0.0.2",
+			md: []string{"forwarded", "for=1.2.3.4", "x-forwarded-for", "198.51.100.9"}, want: "198.51.100.9"},
+		{name: "Should ignore a forged X-Real-IP header behind an X-Forwarded-For proxy", peer: "127.0.0.1",
+			md: []string{"x-forwarded-for", "10.0.0.3", "x-real-ip", "198.51.100.2"}, want: "10.0.0.3"},
+		{name: "Should read the configured Forwarded header", header: middleware.ProxyHeaderForwarded, peer: "127.0.0.1",
+			md: []string{"x-forwarded-for", "198.51.100.9", "forwarded",
+				`for=198.51.100.1;proto=https, for="[2001:db8::1]:4711"`},
+			want: "198.51.100.1"},
+		{name: "Should read the configured X-Real-IP header", header: middleware.ProxyHeaderXRealIP, peer: "127.0.0.1",
+			md: []string{"x-forwarded-for", "198.51.100.9", "x-real-ip", "198.51.100.2"}, want: "198.51.100.2"},
+		{name: "Should stop at an obfuscated hop", header: middleware.ProxyHeaderForwarded, peer: "127.0.0.1",
+			md: []string{"forwarded", "for=_hidden, for=10.0.0.4"}, want: "10.0.0.4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := tt.header
+			if header == "" {
+				header = middleware.ProxyHeaderXForwardedFor
+			}
+
+			ctx := peer.NewContext(context.Background(), &peer.Peer{
+				Addr: &net.TCPAddr{IP: net.ParseIP(tt.peer), Port: 50000},
+			})
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(tt.md...))
+
+			got, err := proxies.WithHeader(header).ClientIP(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got.String())
+		})
+	}
+}
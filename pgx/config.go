@@ -0,0 +1,185 @@
+package pgx
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/spf13/cast"
+
+	"github.com/cozy-hub-app/framework/env"
+	"github.com/cozy-hub-app/framework/logger"
+)
+
+// redactedPassword replaces the password whenever the config is logged
+const redactedPassword = "xxxxx"
+
+// Config holds the database connection and pool configuration
+type Config struct {
+	// URL is a full connection string (DATABASE_URL), it overrides the individual connection fields
+	URL string
+
+	Host     string
+	Port     string
+	User     string
+	Password string
+	Name     string
+
+	// TLS settings, SSLMode defaults to "disable" when empty
+	SSLMode     string
+	SSLRootCert string
+	SSLCert     string
+	SSLKey      string
+
+	// Pool settings, zero values keep the pgxpool defaults
+	MaxConns          int32
+	MinConns          int32
+	MaxConnLifetime   time.Duration
+	MaxConnIdleTime   time.Duration
+	HealthCheckPeriod time.Duration
+
+	// Read replicas, either full connection strings or host[:port] entries sharing the
+	// primary credentials and settings
+	ReplicaURLs              []string
+	ReplicaHosts             []string
+	ReplicaHealthCheckPeriod time.Duration
+}
+
+// ConfigFromEnv builds the database configuration from environment variables
+func ConfigFromEnv() *Config {
+	return &Config{
+		URL:               env.Get(env.DatabaseURL),
+		Host:              env.Get(env.DBHost),
+		Port:              env.Get(env.DBPort),
+		User:              env.Get(env.DBUser),
+		Password:          env.Get(env.DBPassword),
+		Name:              env.Get(env.DBName),
+		SSLMode:           env.GetOrDefault(env.DBSSLMode, "disable"),
+		SSLRootCert:       env.Get(env.DBSSLRootCert),
+		SSLCert:           env.Get(env.DBSSLCert),
+		SSLKey:            env.Get(env.DBSSLKey),
+		MaxConns:          cast.ToInt32(env.Get(env.DBMaxConns)),
+		MinConns:          cast.ToInt32(env.Get(env.DBMinConns)),
+		MaxConnLifetime:   durationFromEnv(env.DBMaxConnLifetime),
+		MaxConnIdleTime:   durationFromEnv(env.DBMaxConnIdleTime),
+		HealthCheckPeriod: durationFromEnv(env.DBHealthCheckPeriod),
+
+		ReplicaURLs:              env.GetList(env.DatabaseReplicaURLs),
+		ReplicaHosts:             env.GetList(env.DBReplicaHosts),
+		ReplicaHealthCheckPeriod: durationFromEnv(env.DBReplicaHealthCheckPeriod),
+	}
+}
+
+// durationFromEnv parses a duration variable, a bare number is a count of seconds.
+// An invalid value is logged and keeps the pgxpool default.
+func durationFromEnv(key string) time.Duration {
+	d, err := env.ParseDuration(env.Get(key))
+	if err != nil {
+		logger.RestrictedGet().Warn("ignoring invalid duration", "variable", key, "error", err)
+		return 0
+	}
+	return d
+}
+
+// ConnString returns the connection string used to connect to the database
+func (c *Config) ConnString() string {
+	return c.connString(c.Password)
+}
+
+// Redacted returns the connection string with the password masked, safe for logging
+func (c *Config) Redacted() string {
+	if c.URL != "" {
+		u, err := url.Parse(c.URL)
+		if err != nil || u.Scheme == "" {
+			// never log a keyword/value or unparsable DSN, it may contain the password
+			return "<redacted DATABASE_URL>"
+		}
+		if q := u.Query(); q.Has("password") {
+			q.Set("password", redactedPassword)
+			u.RawQuery = q.Encode()
+		}
+		return u.Redacted()
+	}
+
+	if c.Password == "" {
+		return c.connString("")
+	}
+	return c.connString(redactedPassword)
+}
+
+// connString builds the connection string with the given password
+func (c *Config) connString(password string) string {
+	if c.URL != "" {
+		return c.URL
+	}
+
+	sslMode := c.SSLMode
+	if sslMode == "" {
+		sslMode = "disable"
+	}
+
+	params := []struct{ key, value string }{
+		{"host", c.Host},
+		{"port", c.Port},
+		{"user", c.User},
+		{"password", password},
+		{"dbname", c.Name},
+		{"sslmode", sslMode},
+		{"sslrootcert", c.SSLRootCert},
+		{"sslcert", c.SSLCert},
+		{"sslkey", c.SSLKey},
+	}
+
+	parts := make([]string, 0, len(params))
+	for _, p := range params {
+		if p.value != "" {
+			parts = append(parts, fmt.Sprintf("%s=%s", p.key, quoteDSNValue(p.value)))
+		}
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// poolConfig parses the connection string and applies the pool settings
+func (c *Config) poolConfig() (*pgxpool.Config, error) {
+	poolCfg, err := pgxpool.ParseConfig(c.ConnString())
+	if err != nil {
+		// pgconn redacts the password from parse errors
+		return nil, fmt.Errorf("failed to parse database config: %w", err)
+	}
+
+	if c.MaxConns > 0 {
+		poolCfg.MaxConns = c.MaxConns
+	}
+	if c.MinConns > 0 {
+		poolCfg.MinConns = c.MinConns
+	}
+	if c.MaxConnLifetime > 0 {
+		poolCfg.MaxConnLifetime = c.MaxConnLifetime
+	}
+	if c.MaxConnIdleTime > 0 {
+		poolCfg.MaxConnIdleTime = c.MaxConnIdleTime
+	}
+	if c.HealthCheckPeriod > 0 {
+		poolCfg.HealthCheckPeriod = c.HealthCheckPeriod
+	}
+
+	// Record per-query duration metrics
+	if poolCfg.ConnConfig.Tracer == nil {
+		poolCfg.ConnConfig.Tracer = queryTracer{}
+	}
+
+	return poolCfg, nil
+}
+
+// quoteDSNValue quotes a keyword/value DSN value when it contains spaces or quotes
+func quoteDSNValue(v string) string {
+	if !strings.ContainsAny(v, ` '\`) {
+		return v
+	}
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `'`, `\'`)
+	return "'" + v + "'"
+}
@@ -0,0 +1,106 @@
+package pgx_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cozy-hub-app/framework/env"
+	"github.com/cozy-hub-app/framework/pgx"
+)
+
+func TestConfigConnString(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  pgx.Config
+		want string
+	}{
+		{
+			name: "Should default sslmode to disable",
+			cfg:  pgx.Config{Host: "db", Port: "5432", User: "app", Password: "secret", Name: "cart"},
+			want: "host=db port=5432 user=app password=secret dbname=cart sslmode=disable",
+		},
+		{
+			name: "Should include TLS settings",
+			cfg: pgx.Config{
+				Host: "db", User: "app", Name: "cart",
+				SSLMode: "verify-full", SSLRootCert: "/certs/ca.pem", SSLCert: "/certs/client.pem", SSLKey: "/certs/client.key",
+			},
+			want: "host=db user=app dbname=cart sslmode=verify-full sslrootcert=/certs/ca.pem " +
+				"sslcert=/certs/client.pem sslkey=/certs/client.key",
+		},
+		{
+			name: "Should quote values with spaces",
+			cfg:  pgx.Config{Host: "db", Password: "it's a secret"},
+			want: `host=db password='it\'s a secret' sslmode=disable`,
+		},
+		{
+			name: "Should prefer the database url",
+			cfg:  pgx.Config{URL: "postgres://app:secret@db:5432/cart", Host: "ignored"},
+			want: "postgres://app:secret@db:5432/cart",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.cfg.ConnString())
+		})
+	}
+}
+
+func TestConfigRedacted(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  pgx.Config
+		want string
+	}{
+		{
+			name: "Should mask keyword/value password",
+			cfg:  pgx.Config{Host: "db", User: "app", Password: "secret"},
+			want: "host=db user=app password=xxxxx sslmode=disable",
+		},
+		{
+			name: "Should mask url password",
+			cfg:  pgx.Config{URL: "postgres://app:secret@db:5432/cart?sslmode=require"},
+			want: "postgres://app:xxxxx@db:5432/cart?sslmode=require",
+		},
+		{
+			name: "Should mask url query password",
+			cfg:  pgx.Config{URL: "postgres://db/cart?password=secret"},
+			want: "postgres://db/cart?password=xxxxx",
+		},
+		{
+			name: "Should hide keyword/value database url",
+			cfg:  pgx.Config{URL: "host=db password=secret"},
+			want: "<redacted DATABASE_URL>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.cfg.Redacted())
+		})
+	}
+}
+
+func TestConfigFromEnvDurations(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+	}{
+		{"Should read a bare number as seconds", "300", 5 * time.Minute},
+		{"Should parse a Go duration", "90s", 90 * time.Second},
+		{"Should keep the pool default for an invalid value", "soon", 0},
+		{"Should keep the pool default when unset", "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(env.DBMaxConnLifetime, tt.value)
+			t.Setenv(env.DBReplicaHealthCheckPeriod, tt.value)
+
+			cfg := pgx.ConfigFromEnv()
+			assert.Equal(t, tt.want, cfg.MaxConnLifetime)
+			assert.Equal(t, tt.want, cfg.ReplicaHealthCheckPeriod)
+		})
+	}
+}
@@ -5,47 +5,60 @@ import (
 	"fmt"
 
 	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/cozy-hub-app/framework/env"
+
+	"github.com/cozy-hub-app/framework/logger"
 )
 
 //nolint:gochecknoglobals // expected to be at global level
 var _ds *DataSource
 
-// DataSource represents the database connection pool
+// DataSource represents the database connection pool with optional read replicas
 type DataSource struct {
-	pool *pgxpool.Pool
+	pool     *pgxpool.Pool
+	replicas *replicaSet
 }
 
-// Init initializes the database connection pool
+// Init initializes the database connection pool from environment variables
 func Init(ctx context.Context) error {
-	dbHost := env.Get(env.DBHost)
-	dbPort := env.Get(env.DBPort)
-	dbUser := env.Get(env.DBUser)
-	dbPassword := env.Get(env.DBPassword)
-	dbName := env.Get(env.DBName)
-
-	fmt.Printf("DEBUG: DB config - host=%s port=%s user=%s dbname=%s\n", dbHost, dbPort, dbUser, dbName)
-
-	connString := fmt.Sprintf(
-		"host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		dbHost,
-		dbPort,
-		dbUser,
-		dbPassword,
-		dbName,
+	return InitWithConfig(ctx, ConfigFromEnv())
+}
+
+// InitWithConfig initializes the database connection pool with the given configuration
+func InitWithConfig(ctx context.Context, cfg *Config) error {
+	poolCfg, err := cfg.poolConfig()
+	if err != nil {
+		return err
+	}
+
+	logger.RestrictedGet().Info("connecting to database",
+		"dsn", cfg.Redacted(),
+		"max_conns", poolCfg.MaxConns,
+		"min_conns", poolCfg.MinConns,
+		"max_conn_lifetime", poolCfg.MaxConnLifetime.String(),
+		"max_conn_idle_time", poolCfg.MaxConnIdleTime.String(),
+		"health_check_period", poolCfg.HealthCheckPeriod.String(),
+		"replicas", len(cfg.ReplicaURLs)+len(cfg.ReplicaHosts),
 	)
 
-	pool, err := pgxpool.New(ctx, connString)
+	pool, err := pgxpool.NewWithConfig(ctx, poolCfg)
 	if err != nil {
 		return fmt.Errorf("failed to create connection pool: %w", err)
 	}
 
 	// Test the connection
 	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
 		return fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	_ds = &DataSource{pool: pool}
+	replicas, err := newReplicaSet(ctx, cfg)
+	if err != nil {
+		pool.Close()
+		return err
+	}
+
+	_ds = &DataSource{pool: pool, replicas: replicas}
+	registerPoolCollector()
 	return nil
 }
 
@@ -54,13 +67,21 @@ func GetDS() *DataSource {
 	return _ds
 }
 
-// GetPool returns the connection pool
+// GetPool returns the primary connection pool
 func (ds *DataSource) GetPool() *pgxpool.Pool {
 	return ds.pool
 }
 
-// Close closes the connection pool
+// Ping checks the primary connectivity, usable as a health checker
+func (ds *DataSource) Ping(ctx context.Context) error {
+	return ds.pool.Ping(ctx)
+}
+
+// Close closes the primary and replica connection pools
 func (ds *DataSource) Close() {
+	if ds.replicas != nil {
+		ds.replicas.close()
+	}
 	if ds.pool != nil {
 		ds.pool.Close()
 	}
@@ -0,0 +1,170 @@
+package pgx
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	pgxv5 "github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// unnamedQuery labels queries without a name
+const unnamedQuery = "unnamed"
+
+// sqlc style name annotation, e.g. "-- name: GetCart :one"
+var queryNameRegex = regexp.MustCompile(`^\s*--\s*name:\s*(\w+)`)
+
+//nolint:gochecknoglobals // prometheus collectors are registered once per process
+var (
+	// Query duration histogram
+	queryDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "db_query_duration_seconds",
+			Help:    "Database query duration in seconds",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"query", "status"},
+	)
+
+	poolCollectorOnce sync.Once
+)
+
+type queryNameContextKey struct{}
+type queryStartContextKey struct{}
+
+type queryStart struct {
+	name  string
+	start time.Time
+}
+
+// WithQueryName labels the queries executed with ctx in the db_query_duration_seconds histogram.
+// Queries annotated with a "-- name: X" comment are labelled automatically.
+func WithQueryName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, queryNameContextKey{}, name)
+}
+
+// queryTracer records the query duration histogram
+type queryTracer struct{}
+
+func (queryTracer) TraceQueryStart(ctx context.Context, _ *pgxv5.Conn, data pgxv5.TraceQueryStartData) context.Context {
+	return context.WithValue(ctx, queryStartContextKey{}, queryStart{
+		name:  queryName(ctx, data.SQL),
+		start: time.Now(),
+	})
+}
+
+func (queryTracer) TraceQueryEnd(ctx context.Context, _ *pgxv5.Conn, data pgxv5.TraceQueryEndData) {
+	qs, ok := ctx.Value(queryStartContextKey{}).(queryStart)
+	if !ok {
+		return
+	}
+
+	status := "ok"
+	if data.Err != nil {
+		status = "error"
+	}
+	queryDuration.WithLabelValues(qs.name, status).Observe(time.Since(qs.start).Seconds())
+}
+
+// queryName resolves the query label from ctx or the SQL name annotation
+func queryName(ctx context.Context, sql string) string {
+	if name, ok := ctx.Value(queryNameContextKey{}).(string); ok && name != "" {
+		return name
+	}
+	if match := queryNameRegex.FindStringSubmatch(sql); match != nil {
+		return match[1]
+	}
+	return unnamedQuery
+}
+
+// poolCollector exports pgxpool.Stat() of the global datasource pools
+type poolCollector struct {
+	acquiredConns        *prometheus.Desc
+	idleConns            *prometheus.Desc
+	totalConns           *prometheus.Desc
+	maxConns             *prometheus.Desc
+	acquireCount         *prometheus.Desc
+	acquireDuration      *prometheus.Desc
+	canceledAcquireCount *prometheus.Desc
+	emptyAcquireCount    *prometheus.Desc
+}
+
+// newPoolCollector creates the pool stats collector
+func newPoolCollector() *poolCollector {
+	labels := []string{"pool"}
+	return &poolCollector{
+		acquiredConns: prometheus.NewDesc("db_pool_acquired_conns",
+			"Number of currently acquired connections in the pool", labels, nil),
+		idleConns: prometheus.NewDesc("db_pool_idle_conns",
+			"Number of currently idle connections in the pool", labels, nil),
+		totalConns: prometheus.NewDesc("db_pool_total_conns",
+			"Total number of connections currently in the pool", labels, nil),
+		maxConns: prometheus.NewDesc("db_pool_max_conns",
+			"Maximum size of the pool", labels, nil),
+		acquireCount: prometheus.NewDesc("db_pool_acquire_count_total",
+			"Cumulative count of successful acquires from the pool", labels, nil),
+		acquireDuration: prometheus.NewDesc("db_pool_acquire_duration_seconds_total",
+			"Total duration of all successful acquires from the pool in seconds", labels, nil),
+		canceledAcquireCount: prometheus.NewDesc("db_pool_canceled_acquire_count_total",
+			"Cumulative count of acquires canceled by a context", labels, nil),
+		emptyAcquireCount: prometheus.NewDesc("db_pool_empty_acquire_count_total",
+			"Cumulative count of acquires that waited for a connection because the pool was empty", labels, nil),
+	}
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.acquiredConns
+	ch <- c.idleConns
+	ch <- c.totalConns
+	ch <- c.maxConns
+	ch <- c.acquireCount
+	ch <- c.acquireDuration
+	ch <- c.canceledAcquireCount
+	ch <- c.emptyAcquireCount
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	ds := GetDS()
+	if ds == nil {
+		return
+	}
+
+	c.collectPool(ch, "primary", ds.pool)
+	if ds.replicas != nil {
+		for i, r := range ds.replicas.replicas {
+			c.collectPool(ch, fmt.Sprintf("replica_%d", i), r.pool)
+		}
+	}
+}
+
+// collectPool emits the stats of a single pool
+func (c *poolCollector) collectPool(ch chan<- prometheus.Metric, name string, pool *pgxpool.Pool) {
+	if pool == nil {
+		return
+	}
+
+	stat := pool.Stat()
+	ch <- prometheus.MustNewConstMetric(c.acquiredConns, prometheus.GaugeValue, float64(stat.AcquiredConns()), name)
+	ch <- prometheus.MustNewConstMetric(c.idleConns, prometheus.GaugeValue, float64(stat.IdleConns()), name)
+	ch <- prometheus.MustNewConstMetric(c.totalConns, prometheus.GaugeValue, float64(stat.TotalConns()), name)
+	ch <- prometheus.MustNewConstMetric(c.maxConns, prometheus.GaugeValue, float64(stat.MaxConns()), name)
+	ch <- prometheus.MustNewConstMetric(c.acquireCount, prometheus.CounterValue, float64(stat.AcquireCount()), name)
+	ch <- prometheus.MustNewConstMetric(c.acquireDuration, prometheus.CounterValue,
+		stat.AcquireDuration().Seconds(), name)
+	ch <- prometheus.MustNewConstMetric(c.canceledAcquireCount, prometheus.CounterValue,
+		float64(stat.CanceledAcquireCount()), name)
+	ch <- prometheus.MustNewConstMetric(c.emptyAcquireCount, prometheus.CounterValue,
+		float64(stat.EmptyAcquireCount()), name)
+}
+
+// registerPoolCollector registers the pool stats collector on the default registry once
+func registerPoolCollector() {
+	poolCollectorOnce.Do(func() {
+		prometheus.MustRegister(newPoolCollector())
+	})
+}
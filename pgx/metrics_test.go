@@ -0,0 +1,126 @@
+package pgx
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	pgxv5 "github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryName(t *testing.T) {
+	tests := []struct {
+		name string
+		ctx  context.Context
+		sql  string
+		want string
+	}{
+		{"Should read the name annotation", context.Background(), "-- name: GetCart :one\nSELECT * FROM carts", "GetCart"},
+		{"Should allow leading whitespace", context.Background(), "\n  --name:ListItems :many\nSELECT 1", "ListItems"},
+		{"Should prefer the context name", WithQueryName(context.Background(), "cart_lookup"), "-- name: GetCart :one\nSELECT 1", "cart_lookup"},
+		{"Should ignore an empty context name", WithQueryName(context.Background(), ""), "-- name: GetCart :one\nSELECT 1", "GetCart"},
+		{"Should ignore a name annotation after the query", context.Background(), "SELECT 1 -- name: GetCart", unnamedQuery},
+		{"Should fall back to unnamed", context.Background(), "SELECT 1", unnamedQuery},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, queryName(tt.ctx, tt.sql))
+		})
+	}
+}
+
+func TestQueryTracer(t *testing.T) {
+	tracer := queryTracer{}
+	before := querySamples(t, "TraceCart", "error")
+
+	ctx := tracer.TraceQueryStart(context.Background(), nil, pgxv5.TraceQueryStartData{SQL: "-- name: TraceCart :one\nSELECT 1"})
+	tracer.TraceQueryEnd(ctx, nil, pgxv5.TraceQueryEndData{Err: errors.New("boom")})
+
+	assert.Equal(t, before+1, querySamples(t, "TraceCart", "error"))
+}
+
+// querySamples returns the observation count of db_query_duration_seconds for the labels
+func querySamples(t *testing.T, query, status string) uint64 {
+	t.Helper()
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != "db_query_duration_seconds" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := metricLabels(metric)
+			if labels["query"] == query && labels["status"] == status {
+				return metric.GetHistogram().GetSampleCount()
+			}
+		}
+	}
+	return 0
+}
+
+func TestPoolCollector(t *testing.T) {
+	newPool := func(maxConns string) *pgxpool.Pool {
+		// pools connect lazily, no server is needed to read their stats
+		pool, err := pgxpool.New(context.Background(), "postgres://app@127.0.0.1:1/cart?pool_max_conns="+maxConns)
+		require.NoError(t, err)
+		t.Cleanup(pool.Close)
+		return pool
+	}
+
+	previous := _ds
+	t.Cleanup(func() { _ds = previous })
+	_ds = &DataSource{
+		pool: newPool("8"),
+		replicas: &replicaSet{replicas: []*replica{
+			{name: "replica-1", pool: newPool("4")},
+			{name: "replica-2", pool: newPool("2")},
+		}},
+	}
+
+	registry := prometheus.NewPedanticRegistry()
+	require.NoError(t, registry.Register(newPoolCollector()))
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	require.Len(t, families, 8)
+
+	maxConns := make(map[string]float64)
+	for _, family := range families {
+		require.Len(t, family.GetMetric(), 3, family.GetName())
+		if family.GetName() != "db_pool_max_conns" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			maxConns[metricLabels(metric)["pool"]] = metric.GetGauge().GetValue()
+		}
+	}
+	assert.Equal(t, map[string]float64{"primary": 8, "replica_0": 4, "replica_1": 2}, maxConns)
+}
+
+func TestPoolCollectorWithoutDataSource(t *testing.T) {
+	previous := _ds
+	t.Cleanup(func() { _ds = previous })
+	_ds = nil
+
+	registry := prometheus.NewPedanticRegistry()
+	require.NoError(t, registry.Register(newPoolCollector()))
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	assert.Empty(t, families)
+}
+
+// metricLabels returns the label pairs of metric as a map
+func metricLabels(metric *dto.Metric) map[string]string {
+	labels := make(map[string]string)
+	for _, pair := range metric.GetLabel() {
+		labels[pair.GetName()] = pair.GetValue()
+	}
+	return labels
+}
@@ -0,0 +1,69 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// commands accepted by Exec
+const (
+	CommandUp     = "up"
+	CommandDown   = "down"
+	CommandStatus = "status"
+)
+
+// Exec runs a migration command parsed from CLI arguments, e.g. os.Args[1:]:
+//
+//	up           apply all pending migrations
+//	down [n]     roll back the latest n migrations (default 1)
+//	status       log the state of every migration
+func (m *Migrator) Exec(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing migration command, expected one of: %s, %s, %s",
+			CommandUp, CommandDown, CommandStatus)
+	}
+
+	switch args[0] {
+	case CommandUp:
+		count, err := m.Up(ctx)
+		if err != nil {
+			return err
+		}
+		m.logger.Info("migrations applied", "count", count)
+
+	case CommandDown:
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+			steps = n
+		}
+
+		count, err := m.Down(ctx, steps)
+		if err != nil {
+			return err
+		}
+		m.logger.Info("migrations rolled back", "count", count)
+
+	case CommandStatus:
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, st := range statuses {
+			if st.Applied {
+				m.logger.Info("migration applied", "version", st.Version, "name", st.Name, "applied_at", st.AppliedAt)
+			} else {
+				m.logger.Info("migration pending", "version", st.Version, "name", st.Name)
+			}
+		}
+
+	default:
+		return fmt.Errorf("unknown migration command %q", args[0])
+	}
+
+	return nil
+}
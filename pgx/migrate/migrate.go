@@ -0,0 +1,357 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	pgxv5 "github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/cozy-hub-app/framework/logger"
+)
+
+// DefaultTable tracks the applied migration versions
+const DefaultTable = "schema_migrations"
+
+// migration file name: <version>_<name>.<up|down>.sql, e.g. 0001_create_carts.up.sql
+var fileRegex = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+var (
+	// ErrDuplicateVersion is returned when two migration files share a version and direction
+	ErrDuplicateVersion = errors.New("duplicate migration version")
+	// ErrMissingUp is returned when a version only has a down file
+	ErrMissingUp = errors.New("missing up migration")
+	// ErrMissingDown is returned when rolling back a version without a down file
+	ErrMissingDown = errors.New("missing down migration")
+)
+
+// Migration is a versioned pair of up/down SQL scripts
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status reports whether a migration has been applied
+type Status struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Migrator applies embedded SQL migrations to a pgx pool
+type Migrator struct {
+	pool       *pgxpool.Pool
+	table      string
+	migrations []Migration
+	logger     logger.Logger
+}
+
+// Option configures the Migrator
+type Option func(*Migrator)
+
+// WithTable overrides the table tracking applied versions
+func WithTable(table string) Option {
+	return func(m *Migrator) {
+		m.table = table
+	}
+}
+
+// New creates a Migrator reading migrations from fsys (usually an embed.FS)
+func New(pool *pgxpool.Pool, fsys fs.FS, opts ...Option) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewFromMigrations(pool, migrations, opts...), nil
+}
+
+// NewFromMigrations creates a Migrator applying already loaded migrations (see LoadAll)
+func NewFromMigrations(pool *pgxpool.Pool, migrations []Migration, opts ...Option) *Migrator {
+	m := &Migrator{
+		pool:       pool,
+		table:      DefaultTable,
+		migrations: migrations,
+		logger:     logger.RestrictedGet(),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
+}
+
+// LoadAll loads several migration sources into one set sorted by version,
+// a version defined by more than one source is an ErrDuplicateVersion
+func LoadAll(sources ...fs.FS) ([]Migration, error) {
+	var migrations []Migration
+	seen := make(map[int64]int)
+	for i, src := range sources {
+		loaded, err := Load(src)
+		if err != nil {
+			return nil, err
+		}
+		for _, mig := range loaded {
+			if prev, ok := seen[mig.Version]; ok {
+				return nil, fmt.Errorf("%w: version %d in sources %d and %d", ErrDuplicateVersion, mig.Version, prev, i)
+			}
+			seen[mig.Version] = i
+			migrations = append(migrations, mig)
+		}
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Load reads all *.up.sql / *.down.sql files in fsys (recursively) sorted by version
+func Load(fsys fs.FS) ([]Migration, error) {
+	byVersion := make(map[int64]*Migration)
+
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		match := fileRegex.FindStringSubmatch(path.Base(p))
+		if match == nil {
+			return nil
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid migration version %q: %w", p, err)
+		}
+
+		content, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return fmt.Errorf("failed to read migration %q: %w", p, err)
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = mig
+		}
+
+		switch match[3] {
+		case "up":
+			if mig.Up != "" {
+				return fmt.Errorf("%w: %s", ErrDuplicateVersion, p)
+			}
+			mig.Up = string(content)
+		case "down":
+			if mig.Down != "" {
+				return fmt.Errorf("%w: %s", ErrDuplicateVersion, p)
+			}
+			mig.Down = string(content)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" {
+			return nil, fmt.Errorf("%w: version %d", ErrMissingUp, mig.Version)
+		}
+		migrations = append(migrations, *mig)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Up applies all pending migrations and returns how many were applied
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	count := 0
+
+	err := m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+
+			m.logger.Info("applying migration", "version", mig.Version, "name", mig.Name)
+			if err := m.exec(ctx, conn, mig.Up,
+				fmt.Sprintf("INSERT INTO %s (version, name) VALUES ($1, $2)", m.tableIdent()),
+				mig.Version, mig.Name,
+			); err != nil {
+				return fmt.Errorf("failed to apply migration %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			count++
+		}
+
+		return nil
+	})
+
+	return count, err
+}
+
+// Down rolls back the latest `steps` applied migrations and returns how many were rolled back
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	count := 0
+
+	err := m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && count < steps; i-- {
+			mig := m.migrations[i]
+			if _, ok := applied[mig.Version]; !ok {
+				continue
+			}
+			if mig.Down == "" {
+				return fmt.Errorf("%w: version %d", ErrMissingDown, mig.Version)
+			}
+
+			m.logger.Info("rolling back migration", "version", mig.Version, "name", mig.Name)
+			if err := m.exec(ctx, conn, mig.Down,
+				fmt.Sprintf("DELETE FROM %s WHERE version = $1", m.tableIdent()),
+				mig.Version,
+			); err != nil {
+				return fmt.Errorf("failed to roll back migration %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			count++
+		}
+
+		return nil
+	})
+
+	return count, err
+}
+
+// Status returns every known migration with its applied state
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+
+	err := m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		statuses = make([]Status, 0, len(m.migrations))
+		for _, mig := range m.migrations {
+			appliedAt, ok := applied[mig.Version]
+			statuses = append(statuses, Status{
+				Version:   mig.Version,
+				Name:      mig.Name,
+				Applied:   ok,
+				AppliedAt: appliedAt,
+			})
+		}
+
+		return nil
+	})
+
+	return statuses, err
+}
+
+// withLock runs fn on a dedicated connection holding the migration advisory lock,
+// so only one replica migrates at a time
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *pgxpool.Conn) error) error {
+	conn, err := m.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	key := m.lockKey()
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", key); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	defer func() {
+		// use a fresh context, ctx may already be canceled
+		if _, err := conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", key); err != nil {
+			m.logger.Error("failed to release migration lock", "error", err)
+		}
+	}()
+
+	if _, err := conn.Exec(ctx, fmt.Sprintf(
+		`CREATE TABLE IF NOT EXISTS %s (
+			version BIGINT PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)`, m.tableIdent()),
+	); err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+
+	return fn(conn)
+}
+
+// applied returns the applied versions with their timestamp
+func (m *Migrator) applied(ctx context.Context, conn *pgxpool.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.Query(ctx, fmt.Sprintf("SELECT version, applied_at FROM %s", m.tableIdent()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+// exec runs the migration script and the bookkeeping statement in one transaction
+func (m *Migrator) exec(ctx context.Context, conn *pgxpool.Conn, script, record string, args ...any) error {
+	return pgxv5.BeginFunc(ctx, conn, func(tx pgxv5.Tx) error {
+		if _, err := tx.Exec(ctx, script); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, record, args...)
+		return err
+	})
+}
+
+// tableIdent returns the quoted table identifier, supports schema.table
+func (m *Migrator) tableIdent() string {
+	return pgxv5.Identifier(strings.SplitN(m.table, ".", 2)).Sanitize()
+}
+
+// lockKey derives the advisory lock key from the table name
+func (m *Migrator) lockKey() int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte("migrate:" + m.table))
+	return int64(h.Sum64()) //nolint:gosec // overflow is fine for a lock key
+}
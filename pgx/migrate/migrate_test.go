@@ -0,0 +1,81 @@
+package migrate_test
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cozy-hub-app/framework/pgx/migrate"
+)
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/0002_add_cart_items.up.sql":   {Data: []byte("CREATE TABLE cart_items ();")},
+		"migrations/0002_add_cart_items.down.sql": {Data: []byte("DROP TABLE cart_items;")},
+		"migrations/0001_create_carts.up.sql":     {Data: []byte("CREATE TABLE carts ();")},
+		"migrations/README.md":                    {Data: []byte("ignored")},
+	}
+
+	migrations, err := migrate.Load(fsys)
+	require.NoError(t, err)
+	require.Len(t, migrations, 2)
+
+	assert.Equal(t, migrate.Migration{Version: 1, Name: "create_carts", Up: "CREATE TABLE carts ();"}, migrations[0])
+	assert.Equal(t, migrate.Migration{
+		Version: 2,
+		Name:    "add_cart_items",
+		Up:      "CREATE TABLE cart_items ();",
+		Down:    "DROP TABLE cart_items;",
+	}, migrations[1])
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		fsys    fstest.MapFS
+		wantErr error
+	}{
+		{
+			name: "Should reject duplicate versions",
+			fsys: fstest.MapFS{
+				"0001_create_carts.up.sql": {Data: []byte("SELECT 1;")},
+				"0001_create_users.up.sql": {Data: []byte("SELECT 1;")},
+			},
+			wantErr: migrate.ErrDuplicateVersion,
+		},
+		{
+			name: "Should reject down without up",
+			fsys: fstest.MapFS{
+				"0001_create_carts.down.sql": {Data: []byte("SELECT 1;")},
+			},
+			wantErr: migrate.ErrMissingUp,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := migrate.Load(tt.fsys)
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestLoadAll(t *testing.T) {
+	carts := fstest.MapFS{
+		"0001_create_carts.up.sql":   {Data: []byte("CREATE TABLE carts ();")},
+		"0003_add_cart_notes.up.sql": {Data: []byte("ALTER TABLE carts ADD notes text;")},
+	}
+
+	migrations, err := migrate.LoadAll(carts, fstest.MapFS{
+		"0002_create_orders.up.sql": {Data: []byte("CREATE TABLE orders ();")},
+	})
+	require.NoError(t, err)
+	require.Len(t, migrations, 3)
+	assert.Equal(t, []int64{1, 2, 3}, []int64{migrations[0].Version, migrations[1].Version, migrations[2].Version})
+
+	_, err = migrate.LoadAll(carts, fstest.MapFS{
+		"0001_create_orders.up.sql": {Data: []byte("CREATE TABLE orders ();")},
+	})
+	assert.ErrorIs(t, err, migrate.ErrDuplicateVersion)
+}
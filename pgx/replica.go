@@ -0,0 +1,236 @@
+package pgx
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/cozy-hub-app/framework/logger"
+)
+
+// replica health check defaults
+const (
+	defaultReplicaHealthCheckPeriod = 10 * time.Second
+	replicaPingTimeout              = 2 * time.Second
+)
+
+type primaryContextKey struct{}
+
+// replica is a read-only pool taken out of rotation while unhealthy
+type replica struct {
+	name    string
+	pool    *pgxpool.Pool
+	healthy atomic.Bool
+}
+
+// replicaSet round-robins reads across healthy replicas
+type replicaSet struct {
+	replicas []*replica
+	next     atomic.Uint64
+	period   time.Duration
+	stop     chan struct{}
+	wg       sync.WaitGroup
+	logger   logger.Logger
+}
+
+// WithPrimary marks ctx so Reader returns the primary, use it after a write to read your own writes
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryContextKey{}, true)
+}
+
+// isPrimaryForced reports whether WithPrimary was applied to ctx
+func isPrimaryForced(ctx context.Context) bool {
+	forced, _ := ctx.Value(primaryContextKey{}).(bool)
+	return forced
+}
+
+// Writer returns the primary pool
+func (ds *DataSource) Writer() *pgxpool.Pool {
+	return ds.pool
+}
+
+// Reader returns the querier for read-only statements: the transaction from ctx when called
+// inside WithTx, the primary when WithPrimary was applied or no replica is healthy,
+// a healthy replica otherwise
+func (ds *DataSource) Reader(ctx context.Context) Querier {
+	if tx, ok := TxFromContext(ctx); ok {
+		return tx
+	}
+	if isPrimaryForced(ctx) || ds.replicas == nil {
+		return ds.pool
+	}
+	if r := ds.replicas.pick(); r != nil {
+		return r.pool
+	}
+	return ds.pool
+}
+
+// replicaConfig is the pool config of a replica and its name in logs
+type replicaConfig struct {
+	name string
+	pool *pgxpool.Config
+}
+
+// replicaConfigs derives one pool config per replica: URL replicas get the primary pool
+// settings, host replicas are a copy of the parsed primary config (DATABASE_URL included)
+// with only the host and port replaced
+func (c *Config) replicaConfigs() ([]replicaConfig, error) {
+	configs := make([]replicaConfig, 0, len(c.ReplicaURLs)+len(c.ReplicaHosts))
+
+	for i, u := range c.ReplicaURLs {
+		rc := *c
+		rc.URL = u
+		poolCfg, err := rc.poolConfig()
+		if err != nil {
+			return nil, fmt.Errorf("replica %d: %w", i, err)
+		}
+		configs = append(configs, replicaConfig{name: rc.Redacted(), pool: poolCfg})
+	}
+
+	if len(c.ReplicaHosts) == 0 {
+		return configs, nil
+	}
+
+	primary, err := c.poolConfig()
+	if err != nil {
+		return nil, err
+	}
+	for _, hostPort := range c.ReplicaHosts {
+		host, port := hostPort, primary.ConnConfig.Port
+		if h, p, err := net.SplitHostPort(hostPort); err == nil {
+			n, err := strconv.ParseUint(p, 10, 16)
+			if err != nil {
+				return nil, fmt.Errorf("replica %s: invalid port: %w", hostPort, err)
+			}
+			host, port = h, uint16(n)
+		}
+
+		poolCfg := primary.Copy()
+		poolCfg.ConnConfig.Host, poolCfg.ConnConfig.Port = host, port
+		// the primary fallback hosts are not replicas
+		poolCfg.ConnConfig.Fallbacks = nil
+		if tlsCfg := poolCfg.ConnConfig.TLSConfig; tlsCfg != nil && tlsCfg.ServerName != "" {
+			poolCfg.ConnConfig.TLSConfig = tlsCfg.Clone()
+			poolCfg.ConnConfig.TLSConfig.ServerName = host
+		}
+
+		configs = append(configs, replicaConfig{
+			name: net.JoinHostPort(host, strconv.Itoa(int(port))),
+			pool: poolCfg,
+		})
+	}
+
+	return configs, nil
+}
+
+// newReplicaSet connects to every replica, unreachable replicas start out of rotation
+func newReplicaSet(ctx context.Context, cfg *Config) (*replicaSet, error) {
+	configs, err := cfg.replicaConfigs()
+	if err != nil || len(configs) == 0 {
+		return nil, err
+	}
+
+	rs := &replicaSet{
+		period: cfg.ReplicaHealthCheckPeriod,
+		stop:   make(chan struct{}),
+		logger: logger.RestrictedGet(),
+	}
+	if rs.period <= 0 {
+		rs.period = defaultReplicaHealthCheckPeriod
+	}
+
+	for i, rc := range configs {
+		pool, err := pgxpool.NewWithConfig(ctx, rc.pool)
+		if err != nil {
+			rs.close()
+			return nil, fmt.Errorf("failed to create replica %d connection pool: %w", i, err)
+		}
+
+		r := &replica{name: rc.name, pool: pool}
+		rs.replicas = append(rs.replicas, r)
+		err = rs.ping(ctx, r)
+		r.healthy.Store(err == nil)
+		if err != nil {
+			rs.logger.Warn("database replica unreachable, starting out of rotation", "replica", r.name, "error", err)
+		}
+	}
+
+	rs.wg.Add(1)
+	go rs.healthCheckRoutine()
+
+	return rs, nil
+}
+
+// pick returns the next healthy replica or nil when none is healthy
+func (rs *replicaSet) pick() *replica {
+	n := uint64(len(rs.replicas))
+	start := rs.next.Add(1)
+	for i := uint64(0); i < n; i++ {
+		if r := rs.replicas[(start+i)%n]; r.healthy.Load() {
+			return r
+		}
+	}
+	return nil
+}
+
+// healthCheckRoutine periodically pings the replicas until close is called
+func (rs *replicaSet) healthCheckRoutine() {
+	defer rs.wg.Done()
+
+	ticker := time.NewTicker(rs.period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-rs.stop:
+			return
+		case <-ticker.C:
+			for _, r := range rs.replicas {
+				rs.check(context.Background(), r)
+			}
+		}
+	}
+}
+
+// ping checks the replica connectivity
+func (rs *replicaSet) ping(ctx context.Context, r *replica) error {
+	ctx, cancel := context.WithTimeout(ctx, replicaPingTimeout)
+	defer cancel()
+	return r.pool.Ping(ctx)
+}
+
+// check pings the replica and updates its rotation state
+func (rs *replicaSet) check(ctx context.Context, r *replica) {
+	err := rs.ping(ctx, r)
+	healthy := err == nil
+	if r.healthy.Swap(healthy) == healthy {
+		return
+	}
+
+	if healthy {
+		rs.logger.Info("database replica back in rotation", "replica", r.name)
+	} else {
+		rs.logger.Warn("database replica removed from rotation", "replica", r.name, "error", err)
+	}
+}
+
+// close stops the health checks and closes the replica pools
+func (rs *replicaSet) close() {
+	select {
+	case <-rs.stop:
+		return
+	default:
+		close(rs.stop)
+	}
+	rs.wg.Wait()
+
+	for _, r := range rs.replicas {
+		r.pool.Close()
+	}
+}
@@ -0,0 +1,172 @@
+package pgx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	pgxv5 "github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// retryable SQLSTATE codes
+const (
+	sqlStateSerializationFailure = "40001"
+	sqlStateDeadlockDetected     = "40P01"
+)
+
+// transaction retry defaults
+const (
+	defaultTxMaxRetries = 3
+	defaultTxBackoff    = 50 * time.Millisecond
+	maxTxBackoff        = 2 * time.Second
+)
+
+type txContextKey struct{}
+
+// ErrTxOptionsConflict is returned by a nested WithTx whose options the outer transaction cannot honor
+var ErrTxOptionsConflict = errors.New("nested transaction options conflict with the outer transaction")
+
+// txState is the transaction propagated through the context and the options it was started with
+type txState struct {
+	tx   pgxv5.Tx
+	opts TxOptions
+}
+
+// TxOptions configures a transaction started by WithTx
+type TxOptions struct {
+	// IsoLevel defaults to the server default (read committed) when empty
+	IsoLevel pgxv5.TxIsoLevel
+	ReadOnly bool
+	// MaxRetries on serialization failures and deadlocks, 0 uses the default (3), negative disables retries
+	MaxRetries int
+	// Backoff is the base delay between retries, doubled on every attempt with jitter
+	Backoff time.Duration
+}
+
+// TxFunc is executed inside a transaction.
+// ctx carries the transaction so nested WithTx and Querier calls reuse it.
+type TxFunc func(ctx context.Context, tx pgxv5.Tx) error
+
+// Querier is implemented by both the pool and a transaction
+type Querier interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgxv5.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgxv5.Row
+}
+
+// TxFromContext returns the transaction propagated by WithTx, if any
+func TxFromContext(ctx context.Context) (pgxv5.Tx, bool) {
+	state, ok := ctx.Value(txContextKey{}).(*txState)
+	if !ok {
+		return nil, false
+	}
+	return state.tx, true
+}
+
+// Querier returns the transaction from ctx when called inside WithTx, the pool otherwise.
+// Repositories should use it so they join an outer transaction transparently.
+func (ds *DataSource) Querier(ctx context.Context) Querier {
+	if tx, ok := TxFromContext(ctx); ok {
+		return tx
+	}
+	return ds.pool
+}
+
+// WithTx runs fn inside a transaction, committing when fn returns nil and rolling back
+// on error or panic. Serialization failures (40001) and deadlocks (40P01) are retried
+// with exponential backoff. When ctx already carries a transaction, fn joins it and
+// retries are left to the outermost call: a nested call fails with ErrTxOptionsConflict
+// when it asks for another isolation level, or for writes inside a read-only transaction.
+func (ds *DataSource) WithTx(ctx context.Context, opts TxOptions, fn TxFunc) error {
+	if state, ok := ctx.Value(txContextKey{}).(*txState); ok {
+		if err := state.opts.join(opts); err != nil {
+			return err
+		}
+		return fn(ctx, state.tx)
+	}
+
+	maxRetries := opts.MaxRetries
+	if maxRetries == 0 {
+		maxRetries = defaultTxMaxRetries
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := ds.runTx(ctx, opts, fn)
+		if err == nil || !isRetryable(err) || attempt >= maxRetries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(txBackoff(opts.Backoff, attempt)):
+		}
+	}
+}
+
+// runTx executes a single transaction attempt
+func (ds *DataSource) runTx(ctx context.Context, opts TxOptions, fn TxFunc) (err error) {
+	txOpts := pgxv5.TxOptions{IsoLevel: opts.IsoLevel}
+	if opts.ReadOnly {
+		txOpts.AccessMode = pgxv5.ReadOnly
+	}
+
+	tx, err := ds.pool.BeginTx(ctx, txOpts)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback(ctx)
+			panic(p)
+		}
+	}()
+
+	if err := fn(context.WithValue(ctx, txContextKey{}, &txState{tx: tx, opts: opts}), tx); err != nil {
+		if rbErr := tx.Rollback(ctx); rbErr != nil && !errors.Is(rbErr, pgxv5.ErrTxClosed) {
+			return errors.Join(err, rbErr)
+		}
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// join checks that a nested call with inner options can run in a transaction started with o
+func (o TxOptions) join(inner TxOptions) error {
+	if inner.IsoLevel != "" && inner.IsoLevel != o.IsoLevel {
+		return fmt.Errorf("%w: isolation level %q inside %q", ErrTxOptionsConflict, inner.IsoLevel, o.IsoLevel)
+	}
+	if o.ReadOnly && !inner.ReadOnly {
+		return fmt.Errorf("%w: read-write inside a read-only transaction", ErrTxOptionsConflict)
+	}
+	return nil
+}
+
+// isRetryable reports whether the transaction failed due to a serialization failure or deadlock
+func isRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	return pgErr.Code == sqlStateSerializationFailure || pgErr.Code == sqlStateDeadlockDetected
+}
+
+// txBackoff returns the delay before the next attempt: base * 2^attempt plus up to 50% jitter
+func txBackoff(base time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		base = defaultTxBackoff
+	}
+
+	// compare before shifting so a large base or attempt cannot overflow
+	delay := maxTxBackoff
+	if attempt < 32 && base <= maxTxBackoff>>attempt {
+		delay = base << attempt
+	}
+
+	return delay + rand.N(delay/2+1)
+}
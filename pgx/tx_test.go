@@ -0,0 +1,79 @@
+package pgx
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	pgxv5 "github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"Should retry serialization failures", &pgconn.PgError{Code: "40001"}, true},
+		{"Should retry deadlocks", &pgconn.PgError{Code: "40P01"}, true},
+		{"Should retry wrapped errors", fmt.Errorf("commit: %w", &pgconn.PgError{Code: "40001"}), true},
+		{"Should not retry unique violations", &pgconn.PgError{Code: "23505"}, false},
+		{"Should not retry other errors", errors.New("connection reset"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, isRetryable(tt.err))
+		})
+	}
+}
+
+func TestTxBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		base    time.Duration
+		attempt int
+		min     time.Duration
+	}{
+		{"Should default the base", 0, 0, defaultTxBackoff},
+		{"Should double on every attempt", 10 * time.Millisecond, 3, 80 * time.Millisecond},
+		{"Should clamp long delays", time.Second, 5, maxTxBackoff},
+		{"Should clamp shift overflows", time.Millisecond, 63, maxTxBackoff},
+		{"Should clamp a huge base", time.Duration(1) << 62, 2, maxTxBackoff},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := txBackoff(tt.base, tt.attempt)
+			assert.GreaterOrEqual(t, got, tt.min)
+			assert.LessOrEqual(t, got, tt.min+tt.min/2, "Should add at most 50% jitter")
+		})
+	}
+}
+
+func TestTxOptionsJoin(t *testing.T) {
+	tests := []struct {
+		name  string
+		outer TxOptions
+		inner TxOptions
+		ok    bool
+	}{
+		{"Should join with default options", TxOptions{IsoLevel: pgxv5.Serializable}, TxOptions{}, true},
+		{"Should join the same isolation level", TxOptions{IsoLevel: pgxv5.Serializable},
+			TxOptions{IsoLevel: pgxv5.Serializable}, true},
+		{"Should join read-only inside read-write", TxOptions{}, TxOptions{ReadOnly: true}, true},
+		{"Should reject another isolation level", TxOptions{}, TxOptions{IsoLevel: pgxv5.Serializable}, false},
+		{"Should reject read-write inside read-only", TxOptions{ReadOnly: true}, TxOptions{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.outer.join(tt.inner)
+			if tt.ok {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ErrTxOptionsConflict)
+			}
+		})
+	}
+}
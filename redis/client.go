@@ -0,0 +1,78 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/spf13/cast"
+
+	"github.com/cozy-hub-app/framework/env"
+)
+
+//nolint:gochecknoglobals // expected to be at global level
+var _client *goredis.Client
+
+// Config holds Redis connection configuration
+type Config struct {
+	Host     string
+	Port     string
+	Password string
+	DB       int
+}
+
+// ConfigFromEnv builds the Redis configuration from environment variables
+func ConfigFromEnv() *Config {
+	return &Config{
+		Host:     env.GetOrDefault(env.RedisHost, "localhost"),
+		Port:     env.GetOrDefault(env.RedisPort, "6379"),
+		Password: env.Get(env.RedisPassword),
+		DB:       cast.ToInt(env.Get(env.RedisDB)),
+	}
+}
+
+// Init initializes the Redis client from environment variables
+func Init(ctx context.Context) error {
+	return InitWithConfig(ctx, ConfigFromEnv())
+}
+
+// InitWithConfig initializes the Redis client and verifies the connection
+func InitWithConfig(ctx context.Context, cfg *Config) error {
+	client := goredis.NewClient(&goredis.Options{
+		Addr:     net.JoinHostPort(cfg.Host, cfg.Port),
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+
+	// Test the connection
+	if err := client.Ping(ctx).Err(); err != nil {
+		_ = client.Close()
+		return fmt.Errorf("failed to ping redis: %w", err)
+	}
+
+	_client = client
+	return nil
+}
+
+// GetClient returns the global Redis client instance
+func GetClient() *goredis.Client {
+	return _client
+}
+
+// Ping checks the connectivity of the global Redis client, usable as a health checker
+func Ping(ctx context.Context) error {
+	if _client == nil {
+		return errors.New("redis client is not initialized")
+	}
+	return _client.Ping(ctx).Err()
+}
+
+// Close closes the global Redis client
+func Close() error {
+	if _client == nil {
+		return nil
+	}
+	return _client.Close()
+}
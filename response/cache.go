@@ -0,0 +1,56 @@
+package response
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// CacheHeaders are the HTTP caching headers of a successful response, empty fields are omitted
+type CacheHeaders struct {
+	// CacheControl overrides the cache policy of the gateway, e.g. "public, max-age=60"
+	CacheControl string
+	// ETag identifies the representation, it is quoted when needed
+	ETag string
+	// LastModified is sent in the HTTP date format
+	LastModified time.Time
+}
+
+// SetCacheHeaders sends the cache headers to the gateway through response metadata,
+// which answers conditional requests with 304 Not Modified
+// @param context: relevant server context
+// @param headers: cache headers of the response
+func SetCacheHeaders(ctx context.Context, headers CacheHeaders) error {
+	md := metadata.MD{}
+	if headers.CacheControl != "" {
+		md.Set(mdCacheControl, headers.CacheControl)
+	}
+	if headers.ETag != "" {
+		md.Set(mdETag, quoteETag(headers.ETag))
+	}
+	if !headers.LastModified.IsZero() {
+		md.Set(mdLastModified, headers.LastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if md.Len() == 0 {
+		return nil
+	}
+	return grpc.SetHeader(ctx, md)
+}
+
+// quoteETag returns an entity tag as `"x"` or `W/"x"`
+func quoteETag(etag string) string {
+	weak := strings.HasPrefix(etag, "W/")
+	tag := strings.TrimPrefix(etag, "W/")
+	if !strings.HasPrefix(tag, `"`) {
+		tag = `"` + tag + `"`
+	}
+	if weak {
+		return "W/" + tag
+	}
+	return tag
+}
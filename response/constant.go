@@ -33,6 +33,9 @@ const (
 // grpc metadata [value should be in lower case]
 const (
 	mdHTTPStatusCode = "x-http-statuscode"
+	mdCacheControl   = "cache-control"
+	mdETag           = "etag"
+	mdLastModified   = "last-modified"
 )
 
 // http header key
@@ -48,6 +51,10 @@ const (
 const (
 	ctApplicationJSON = "application/json"
 	ccNoStore         = "no-store, max-age=0"
+
+	challengeBearer       = `Bearer realm="api"`
+	challengeBasic        = `Basic realm="api"`
+	challengeInvalidToken = `, error="invalid_token"`
 )
 
 // verbose error code
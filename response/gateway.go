@@ -0,0 +1,154 @@
+package response
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// ForwardResponseOption records the HTTP status set by Created and Accepted and strips the
+// Grpc-Metadata-* headers, install it with runtime.WithForwardResponseOption.
+// The status is applied by StatusHandler when the response is written, so a marshal error
+// still yields an error status and later options can change the headers.
+// @param context: gateway request context carrying the server metadata
+// @param w: http response writer, wrapped by StatusHandler
+// @param resp: response message, nil before the messages of a stream
+func ForwardResponseOption(ctx context.Context, w http.ResponseWriter, resp proto.Message) error {
+	// internal metadata is never part of the HTTP API
+	for key := range w.Header() {
+		if strings.HasPrefix(key, runtime.MetadataHeaderPrefix) {
+			w.Header().Del(key)
+		}
+	}
+
+	if resp == nil {
+		return nil
+	}
+
+	sw := findStatusWriter(w)
+	if sw == nil || sw.wroteHeader {
+		return nil
+	}
+
+	md, ok := runtime.ServerMetadataFromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	values := md.HeaderMD.Get(mdHTTPStatusCode)
+	if len(values) == 0 {
+		return nil
+	}
+
+	if code, err := strconv.Atoi(values[0]); err == nil && isBodyStatus(code) {
+		sw.status = code
+	}
+	return nil
+}
+
+// StatusHandler wraps the gateway mux so the status recorded by ForwardResponseOption
+// replaces the 200 of a successful response
+// @param next: gateway mux
+func StatusHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(&statusWriter{ResponseWriter: w}, r)
+	})
+}
+
+// statusWriter applies a recorded success status when the header is written
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+// WriteHeader replaces 200 with the recorded status, errors are kept as is
+func (sw *statusWriter) WriteHeader(code int) {
+	if sw.wroteHeader {
+		return
+	}
+	sw.wroteHeader = true
+
+	if code == http.StatusOK && sw.status != 0 {
+		code = sw.status
+	}
+	sw.ResponseWriter.WriteHeader(code)
+}
+
+// Write writes the header first
+func (sw *statusWriter) Write(b []byte) (int, error) {
+	if !sw.wroteHeader {
+		sw.WriteHeader(http.StatusOK)
+	}
+	return sw.ResponseWriter.Write(b)
+}
+
+// Flush supports streaming responses
+func (sw *statusWriter) Flush() {
+	if !sw.wroteHeader {
+		sw.WriteHeader(http.StatusOK)
+	}
+	if f, ok := sw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (sw *statusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
+
+// findStatusWriter returns the statusWriter of w, following Unwrap
+func findStatusWriter(w http.ResponseWriter) *statusWriter {
+	for w != nil {
+		if sw, ok := w.(*statusWriter); ok {
+			return sw
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return nil
+		}
+		w = u.Unwrap()
+	}
+	return nil
+}
+
+// isBodyStatus reports whether code is a success status carrying the response body
+func isBodyStatus(code int) bool {
+	switch code {
+	case http.StatusOK, http.StatusCreated, http.StatusAccepted, http.StatusNonAuthoritativeInfo:
+		return true
+	default:
+		return false
+	}
+}
+
+// SetErrorHeaders sets the headers of an HTTP error response: errors are never cached and
+// 401 carries a WWW-Authenticate challenge (RFC 6750 invalid_token for bad bearer tokens)
+// @param w: http response writer
+// @param err: grpc status error
+func SetErrorHeaders(w http.ResponseWriter, err error) {
+	w.Header().Set(headerCacheControl, ccNoStore)
+
+	if status.Code(err) != codes.Unauthenticated {
+		return
+	}
+
+	challenge := challengeBearer
+	for _, detail := range ReadGRPCError(err).Details {
+		switch ErrCode(detail.Code) {
+		case ErrInvalidToken, ErrTokenExpired:
+			challenge = challengeBearer + challengeInvalidToken
+		case ErrInvalidBasicAuth, ErrEmptyBasicAuth:
+			challenge = challengeBasic
+		}
+	}
+
+	w.Header().Set(headerWWWAuthenticate, challenge)
+}
@@ -0,0 +1,127 @@
+package response_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/cozy-hub-app/framework/response"
+)
+
+// serveForwarded runs ForwardResponseOption behind StatusHandler, then writes like the runtime
+func serveForwarded(statusCode string, write func(w http.ResponseWriter)) *httptest.ResponseRecorder {
+	handler := response.StatusHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if statusCode != "" {
+			ctx = runtime.NewServerMetadataContext(ctx, runtime.ServerMetadata{
+				HeaderMD: metadata.Pairs("x-http-statuscode", statusCode),
+			})
+		}
+		w.Header().Set(runtime.MetadataHeaderPrefix+"X-Http-Statuscode", statusCode)
+		_ = response.ForwardResponseOption(ctx, w, &emptypb.Empty{})
+		write(w)
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/orders", nil))
+	return w
+}
+
+func TestForwardResponseOption(t *testing.T) {
+	body := func(w http.ResponseWriter) { _, _ = w.Write([]byte("{}")) }
+
+	tests := []struct {
+		name       string
+		statusCode string
+		write      func(w http.ResponseWriter)
+		want       int
+	}{
+		{"Should apply Created", "201", body, http.StatusCreated},
+		{"Should apply Accepted", "202", body, http.StatusAccepted},
+		{"Should default to OK", "", body, http.StatusOK},
+		{"Should ignore No Content", "204", body, http.StatusOK},
+		{"Should ignore redirects", "302", body, http.StatusOK},
+		{"Should ignore invalid codes", "abc", body, http.StatusOK},
+		{"Should keep the error status of a failed marshal", "201", func(w http.ResponseWriter) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveForwarded(tt.statusCode, tt.write)
+			assert.Equal(t, tt.want, w.Code)
+			assert.Empty(t, w.Header().Get(runtime.MetadataHeaderPrefix+"X-Http-Statuscode"),
+				"Should strip internal metadata")
+		})
+	}
+}
+
+func TestSetErrorHeaders(t *testing.T) {
+	ctx := context.Background()
+	_, invalidToken := response.Unauthenticated(ctx, response.Empty, response.ErrInvalidToken)
+	_, expiredToken := response.Unauthenticated(ctx, response.Empty, response.ErrTokenExpired)
+	_, basicAuth := response.Unauthenticated(ctx, response.Empty, response.ErrInvalidBasicAuth)
+	_, unauthenticated := response.Unauthenticated(ctx, response.Empty)
+	_, forbidden := response.PermissionDenied(ctx, response.Empty)
+
+	tests := []struct {
+		name      string
+		err       error
+		challenge string
+	}{
+		{"Should flag an invalid bearer token", invalidToken, `Bearer realm="api", error="invalid_token"`},
+		{"Should flag an expired bearer token", expiredToken, `Bearer realm="api", error="invalid_token"`},
+		{"Should challenge basic auth", basicAuth, `Basic realm="api"`},
+		{"Should challenge a bearer token", unauthenticated, `Bearer realm="api"`},
+		{"Should not challenge other errors", forbidden, ""},
+		{"Should not challenge non-status errors", errors.New("boom"), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			response.SetErrorHeaders(w, tt.err)
+			assert.Equal(t, tt.challenge, w.Header().Get("WWW-Authenticate"))
+			assert.Equal(t, "no-store, max-age=0", w.Header().Get("Cache-Control"))
+		})
+	}
+}
+
+// headerStream captures the headers sent with grpc.SetHeader
+type headerStream struct {
+	grpc.ServerTransportStream
+	md metadata.MD
+}
+
+func (s *headerStream) SetHeader(md metadata.MD) error {
+	s.md = metadata.Join(s.md, md)
+	return nil
+}
+
+func TestSetCacheHeadersETag(t *testing.T) {
+	tests := []struct {
+		etag string
+		want string
+	}{
+		{"v1", `"v1"`},
+		{`"v1"`, `"v1"`},
+		{"W/v1", `W/"v1"`},
+		{`W/"v1"`, `W/"v1"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.etag, func(t *testing.T) {
+			stream := &headerStream{}
+			ctx := grpc.NewContextWithServerTransportStream(context.Background(), stream)
+			require.NoError(t, response.SetCacheHeaders(ctx, response.CacheHeaders{ETag: tt.etag}))
+			assert.Equal(t, []string{tt.want}, stream.md.Get("etag"))
+		})
+	}
+}
@@ -120,7 +120,7 @@ func ReadGRPCError(err error) *protov1.GRPCError {
 
 		mErr = anypb.UnmarshalTo(v, &m, proto.UnmarshalOptions{})
 		if mErr != nil {
-			logger.RestrictedGet().Error("failed to unmarshal error detail", mErr, "detail", v)
+			logger.RestrictedGet().Error("failed to unmarshal error detail", "error", mErr, "detail", v)
 			continue // ok to skip failed detail, we used to concentrate more on code & message
 		}
 
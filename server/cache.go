@@ -0,0 +1,222 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/protobuf/proto"
+)
+
+// CachePolicy is the Cache-Control of responses that do not set one through metadata
+type CachePolicy struct {
+	// CacheControl is the header value, e.g. "public, max-age=60, stale-while-revalidate=300"
+	CacheControl string
+}
+
+// NoStoreCachePolicy is the default: API responses always reach the service
+//
+//nolint:gochecknoglobals // constant policy
+var NoStoreCachePolicy = CachePolicy{CacheControl: "no-cache, no-store, must-revalidate"}
+
+// PublicCachePolicy lets browsers and CDNs cache a response for maxAge. Responses to requests
+// carrying an Authorization header or a cookie are downgraded to private.
+func PublicCachePolicy(maxAge time.Duration) CachePolicy {
+	return CachePolicy{CacheControl: fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds()))}
+}
+
+// credentialedKey marks the context of requests carrying credentials
+type credentialedKey struct{}
+
+// hasCredentials reports whether r carries an Authorization header or a cookie
+func hasCredentials(r *http.Request) bool {
+	return r.Header.Get("Authorization") != "" || r.Header.Get("Cookie") != ""
+}
+
+// cacheControlFor returns the policy header, shared caches must not store a credentialed response
+func cacheControlFor(p CachePolicy, credentialed bool) string {
+	if !credentialed {
+		return p.CacheControl
+	}
+
+	directives := strings.Split(p.CacheControl, ",")
+	kept := directives[:0]
+	for _, directive := range directives {
+		directive = strings.TrimSpace(directive)
+		name, _, _ := strings.Cut(strings.ToLower(directive), "=")
+		switch name {
+		case "public":
+			kept = append(kept, "private")
+		case "s-maxage", "proxy-revalidate":
+			// only apply to shared caches
+		default:
+			kept = append(kept, directive)
+		}
+	}
+	return strings.Join(kept, ", ")
+}
+
+// cachePolicies resolves the policy of a response: gRPC method, then route, then default
+type cachePolicies struct {
+	methods  *routeTable[CachePolicy]
+	routes   *routeTable[CachePolicy]
+	fallback CachePolicy
+}
+
+// newCachePolicies creates the default no-store policies
+func newCachePolicies() *cachePolicies {
+	return &cachePolicies{
+		methods:  newRouteTable[CachePolicy](),
+		routes:   newRouteTable[CachePolicy](),
+		fallback: NoStoreCachePolicy,
+	}
+}
+
+// WithDefaultCachePolicy replaces the no-store policy of unmatched responses and errors
+func (g *Gateway) WithDefaultCachePolicy(p CachePolicy) *Gateway {
+	g.cache.fallback = p
+	return g
+}
+
+// WithRouteCachePolicy applies p to successful responses of an HTTP path, a trailing * matches
+// a prefix, e.g. g.WithRouteCachePolicy("/v1/products/*", server.PublicCachePolicy(time.Minute))
+func (g *Gateway) WithRouteCachePolicy(pattern string, p CachePolicy) *Gateway {
+	g.cache.routes.set(pattern, p)
+	return g
+}
+
+// WithMethodCachePolicy applies p to successful responses of a gRPC method, "/pkg.Service/*"
+// matches a whole service. Method policies take precedence over route policies.
+func (g *Gateway) WithMethodCachePolicy(method string, p CachePolicy) *Gateway {
+	g.cache.methods.set(method, p)
+	return g
+}
+
+// forwardCachePolicy applies the method policy unless the handler set Cache-Control
+// through metadata, it runs as a runtime forward response option
+func (g *Gateway) forwardCachePolicy(ctx context.Context, w http.ResponseWriter, _ proto.Message) error {
+	if w.Header().Get("Cache-Control") != "" {
+		return nil
+	}
+
+	method, ok := runtime.RPCMethod(ctx)
+	if !ok {
+		return nil
+	}
+	if p, ok := g.cache.methods.lookup(method); ok {
+		credentialed, _ := ctx.Value(credentialedKey{}).(bool)
+		w.Header().Set("Cache-Control", cacheControlFor(p, credentialed))
+	}
+	return nil
+}
+
+// cacheMiddleware applies the route or default policy to responses without Cache-Control
+// and answers conditional GET and HEAD requests with 304 Not Modified
+func (g *Gateway) cacheMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hasCredentials(r) {
+			r = r.WithContext(context.WithValue(r.Context(), credentialedKey{}, true))
+		}
+		next.ServeHTTP(&cacheWriter{ResponseWriter: w, r: r, policies: g.cache}, r)
+	})
+}
+
+// cacheWriter sets the cache headers right before the status is written
+type cacheWriter struct {
+	http.ResponseWriter
+	r           *http.Request
+	policies    *cachePolicies
+	wroteHeader bool
+	notModified bool
+}
+
+// WriteHeader applies the policy and turns a fresh 200 into a 304
+func (cw *cacheWriter) WriteHeader(code int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+
+	h := cw.Header()
+	if h.Get("Cache-Control") == "" {
+		policy := cw.policies.fallback
+		if code >= 200 && code < 300 {
+			if p, ok := cw.policies.routes.lookup(cw.r.URL.Path); ok {
+				policy = p
+			}
+		}
+		h.Set("Cache-Control", cacheControlFor(policy, hasCredentials(cw.r)))
+	}
+
+	if code == http.StatusOK && (cw.r.Method == http.MethodGet || cw.r.Method == http.MethodHead) &&
+		notModified(cw.r, h) {
+		cw.notModified = true
+		h.Del("Content-Type")
+		h.Del("Content-Length")
+		h.Del("Transfer-Encoding")
+		code = http.StatusNotModified
+	}
+
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+// Write discards the body of a 304
+func (cw *cacheWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.notModified {
+		return len(b), nil
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// Flush supports streaming responses
+func (cw *cacheWriter) Flush() {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (cw *cacheWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// notModified evaluates If-None-Match, or If-Modified-Since when absent, per RFC 9110
+func notModified(r *http.Request, h http.Header) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		etag := h.Get("ETag")
+		if etag == "" {
+			return false
+		}
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimSpace(candidate)
+			// weak comparison, W/"x" matches "x"
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	ims, lm := r.Header.Get("If-Modified-Since"), h.Get("Last-Modified")
+	if ims == "" || lm == "" {
+		return false
+	}
+	since, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(lm)
+	if err != nil {
+		return false
+	}
+	return !modified.After(since)
+}
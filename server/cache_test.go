@@ -0,0 +1,131 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouteTableLookup(t *testing.T) {
+	table := newRouteTable[string]()
+	table.set("/v1/*", "v1")
+	table.set("/v1/products/*", "products")
+	table.set("/v1/products/featured", "featured")
+	table.set("*", "any")
+
+	tests := []struct {
+		name string
+		key  string
+		want string
+	}{
+		{"Should prefer the exact match", "/v1/products/featured", "featured"},
+		{"Should prefer the longest prefix", "/v1/products/42", "products"},
+		{"Should fall back to a shorter prefix", "/v1/cart", "v1"},
+		{"Should match the catch-all", "/v2/cart", "any"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := table.lookup(tt.key)
+			assert.True(t, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, ok := newRouteTable[string]().lookup("/v1/cart")
+	assert.False(t, ok, "Should not match an empty table")
+}
+
+func TestNotModified(t *testing.T) {
+	lastModified := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		request  map[string]string
+		response map[string]string
+		want     bool
+	}{
+		{"Should match the ETag", map[string]string{"If-None-Match": `"a"`}, map[string]string{"ETag": `"a"`}, true},
+		{"Should match one of the ETags", map[string]string{"If-None-Match": `"a", "b"`},
+			map[string]string{"ETag": `"b"`}, true},
+		{"Should compare weakly", map[string]string{"If-None-Match": `W/"a"`}, map[string]string{"ETag": `"a"`}, true},
+		{"Should match *", map[string]string{"If-None-Match": "*"}, map[string]string{"ETag": `"a"`}, true},
+		{"Should not match another ETag", map[string]string{"If-None-Match": `"a"`},
+			map[string]string{"ETag": `"b"`}, false},
+		{"Should ignore If-Modified-Since when If-None-Match is set", map[string]string{
+			"If-None-Match": `"a"`, "If-Modified-Since": lastModified.Format(http.TimeFormat),
+		}, map[string]string{"ETag": `"b"`, "Last-Modified": lastModified.Format(http.TimeFormat)}, false},
+		{"Should match an unmodified resource", map[string]string{"If-Modified-Since": lastModified.Format(http.TimeFormat)},
+			map[string]string{"Last-Modified": lastModified.Format(http.TimeFormat)}, true},
+		{"Should not match a modified resource", map[string]string{
+			"If-Modified-Since": lastModified.Add(-time.Hour).Format(http.TimeFormat),
+		}, map[string]string{"Last-Modified": lastModified.Format(http.TimeFormat)}, false},
+		{"Should not match an invalid date", map[string]string{"If-Modified-Since": "yesterday"},
+			map[string]string{"Last-Modified": lastModified.Format(http.TimeFormat)}, false},
+		{"Should not match without validators", map[string]string{}, map[string]string{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/v1/products", nil)
+			for k, v := range tt.request {
+				r.Header.Set(k, v)
+			}
+			h := http.Header{}
+			for k, v := range tt.response {
+				h.Set(k, v)
+			}
+			assert.Equal(t, tt.want, notModified(r, h))
+		})
+	}
+}
+
+func TestCacheMiddleware(t *testing.T) {
+	g := &Gateway{cache: newCachePolicies()}
+	g.WithRouteCachePolicy("/v1/products/*", PublicCachePolicy(time.Minute))
+	handler := g.cacheMiddleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"42"}`))
+	}))
+	serve := func(path string, headers map[string]string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	t.Run("Should apply the route policy", func(t *testing.T) {
+		w := serve("/v1/products/42", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "public, max-age=60", w.Header().Get("Cache-Control"))
+		assert.Equal(t, `{"id":"42"}`, w.Body.String())
+	})
+
+	t.Run("Should apply the default policy", func(t *testing.T) {
+		w := serve("/v1/cart", nil)
+		assert.Equal(t, NoStoreCachePolicy.CacheControl, w.Header().Get("Cache-Control"))
+	})
+
+	t.Run("Should downgrade credentialed responses to private", func(t *testing.T) {
+		w := serve("/v1/products/42", map[string]string{"Authorization": "Bearer token"})
+		assert.Equal(t, "private, max-age=60", w.Header().Get("Cache-Control"))
+		w = serve("/v1/products/42", map[string]string{"Cookie": "session=1"})
+		assert.Equal(t, "private, max-age=60", w.Header().Get("Cache-Control"))
+		assert.Equal(t, "private, max-age=60",
+			cacheControlFor(CachePolicy{CacheControl: "public, max-age=60, s-maxage=300"}, true),
+			"Should drop shared cache directives")
+	})
+
+	t.Run("Should answer 304 without a body", func(t *testing.T) {
+		w := serve("/v1/products/42", map[string]string{"If-None-Match": `"v1"`})
+		assert.Equal(t, http.StatusNotModified, w.Code)
+		assert.Empty(t, w.Body.String())
+		assert.Empty(t, w.Header().Get("Content-Type"))
+		assert.Equal(t, `"v1"`, w.Header().Get("ETag"))
+	})
+}
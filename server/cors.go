@@ -0,0 +1,275 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cozy-hub-app/framework/env"
+)
+
+// corsRegexPrefix marks an allowed origin as a regular expression
+const corsRegexPrefix = "regex:"
+
+// defaultCORSOrigins are the local frontends allowed in addition to CORS_ALLOWED_ORIGINS
+//
+//nolint:gochecknoglobals // constant defaults
+var defaultCORSOrigins = []string{
+	"http://localhost:8000",
+	"http://localhost:3000",
+	"http://localhost:5173", // Vite default
+	"http://localhost:8083", // Admin dashboard
+}
+
+// CORSConfig describes the cross-origin requests accepted by the gateway
+type CORSConfig struct {
+	// AllowedOrigins are exact origins, "*", wildcards like "https://*.example.com"
+	// or regular expressions prefixed with "regex:", e.g. "regex:https://pr-[0-9]+\.example\.com".
+	// Expressions match the whole origin, case-insensitively.
+	AllowedOrigins []string
+	// AllowedMethods default to GET, POST, PUT, PATCH, DELETE
+	AllowedMethods []string
+	// AllowedHeaders are the request headers a client may send, "*" allows any
+	AllowedHeaders []string
+	// ExposedHeaders are the response headers readable by scripts
+	ExposedHeaders []string
+	// AllowCredentials lets browsers send cookies and read credentialed responses
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight response, 0 omits the header
+	MaxAge time.Duration
+	// Routes override the whole policy for matching paths, a trailing * matches a prefix
+	Routes map[string]CORSConfig
+}
+
+// CORSConfigFromEnv returns the default policy: the local frontends and the comma-separated
+// CORS_ALLOWED_ORIGINS, with credentials
+func CORSConfigFromEnv() CORSConfig {
+	return CORSConfig{
+		AllowedOrigins: append(append([]string{}, defaultCORSOrigins...), env.GetList(env.CORSAllowedOrigins)...),
+		AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+		AllowedHeaders: []string{"Content-Type", "Authorization", "X-Requested-With", "X-Session-ID", "X-CSRF-Token"},
+		ExposedHeaders: []string{
+			"X-CSRF-Token", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "Retry-After",
+		},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}
+}
+
+// CORSPolicy is a compiled CORSConfig
+type CORSPolicy struct {
+	anyOrigin        bool
+	origins          map[string]bool
+	patterns         []*regexp.Regexp
+	methods          map[string]bool
+	allowMethods     string
+	anyHeader        bool
+	headers          map[string]bool
+	allowHeaders     string
+	exposeHeaders    string
+	allowCredentials bool
+	maxAge           string
+
+	routes *routeTable[*CORSPolicy]
+}
+
+// NewCORSPolicy validates and compiles cfg, it is evaluated once at startup
+func NewCORSPolicy(cfg CORSConfig) (*CORSPolicy, error) {
+	p, err := compileCORS(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	p.routes = newRouteTable[*CORSPolicy]()
+	for pattern, routeCfg := range cfg.Routes {
+		if len(routeCfg.Routes) > 0 {
+			return nil, fmt.Errorf("CORS route %s: nested routes are not supported", pattern)
+		}
+		route, err := compileCORS(routeCfg)
+		if err != nil {
+			return nil, fmt.Errorf("CORS route %s: %w", pattern, err)
+		}
+		p.routes.set(pattern, route)
+	}
+
+	return p, nil
+}
+
+// compileCORS compiles a single policy
+func compileCORS(cfg CORSConfig) (*CORSPolicy, error) {
+	p := &CORSPolicy{
+		origins:          make(map[string]bool),
+		methods:          make(map[string]bool),
+		headers:          make(map[string]bool),
+		allowCredentials: cfg.AllowCredentials,
+	}
+
+	for _, origin := range cfg.AllowedOrigins {
+		origin = strings.TrimSpace(origin)
+		switch {
+		case origin == "*":
+			p.anyOrigin = true
+		case strings.HasPrefix(origin, corsRegexPrefix):
+			re, err := regexp.Compile(`(?i)^(?:` + strings.TrimPrefix(origin, corsRegexPrefix) + `)$`)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CORS origin %q: %w", origin, err)
+			}
+			p.patterns = append(p.patterns, re)
+		case strings.Contains(origin, "*"):
+			// a wildcard matches one or more DNS labels
+			label := `[a-z0-9-]+(\.[a-z0-9-]+)*`
+			expr := "(?i)^" + strings.ReplaceAll(regexp.QuoteMeta(origin), `\*`, label) + "$"
+			p.patterns = append(p.patterns, regexp.MustCompile(expr))
+		case origin != "":
+			p.origins[strings.TrimSuffix(strings.ToLower(origin), "/")] = true
+		}
+	}
+	if p.anyOrigin && p.allowCredentials {
+		return nil, errors.New("the * origin cannot be combined with credentials")
+	}
+
+	allowedMethods := cfg.AllowedMethods
+	if len(allowedMethods) == 0 {
+		allowedMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE"}
+	}
+	methods := make([]string, 0, len(allowedMethods))
+	for _, method := range allowedMethods {
+		method = strings.ToUpper(strings.TrimSpace(method))
+		p.methods[method] = true
+		methods = append(methods, method)
+	}
+	p.allowMethods = strings.Join(methods, ", ")
+
+	for _, header := range cfg.AllowedHeaders {
+		header = strings.TrimSpace(header)
+		if header == "*" {
+			p.anyHeader = true
+			continue
+		}
+		p.headers[strings.ToLower(header)] = true
+	}
+	p.allowHeaders = strings.Join(cfg.AllowedHeaders, ", ")
+	p.exposeHeaders = strings.Join(cfg.ExposedHeaders, ", ")
+
+	if cfg.MaxAge > 0 {
+		p.maxAge = strconv.Itoa(int(cfg.MaxAge.Seconds()))
+	}
+	return p, nil
+}
+
+// WithCORS replaces the policy built from CORSConfigFromEnv, call it before WithServiceHandler
+func (g *Gateway) WithCORS(p *CORSPolicy) *Gateway {
+	g.cors = p
+	return g
+}
+
+// forPath returns the policy of a request path
+func (p *CORSPolicy) forPath(path string) *CORSPolicy {
+	if route, ok := p.routes.lookup(path); ok {
+		return route
+	}
+	return p
+}
+
+// originAllowed reports whether a request origin is allowed
+func (p *CORSPolicy) originAllowed(origin string) bool {
+	if p.anyOrigin {
+		return true
+	}
+
+	if p.origins[strings.ToLower(origin)] {
+		return true
+	}
+	for _, re := range p.patterns {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// headersAllowed reports whether every header of an Access-Control-Request-Headers list is allowed
+func (p *CORSPolicy) headersAllowed(requested string) bool {
+	if p.anyHeader {
+		return true
+	}
+	for _, header := range strings.Split(requested, ",") {
+		header = strings.ToLower(strings.TrimSpace(header))
+		if header != "" && !p.headers[header] {
+			return false
+		}
+	}
+	return true
+}
+
+// middleware applies the policy of the request path and answers preflight requests
+func (p *CORSPolicy) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		policy := p.forPath(r.URL.Path)
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		// the response depends on the Origin, shared caches must not mix them
+		if !policy.anyOrigin {
+			w.Header().Add("Vary", "Origin")
+		}
+		if preflight {
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+		}
+
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		allowed := policy.originAllowed(origin)
+		if !preflight {
+			if allowed {
+				policy.setOriginHeaders(w, origin)
+				if policy.exposeHeaders != "" {
+					w.Header().Set("Access-Control-Expose-Headers", policy.exposeHeaders)
+				}
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		requestHeaders := r.Header.Get("Access-Control-Request-Headers")
+		if !allowed ||
+			!policy.methods[strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))] ||
+			!policy.headersAllowed(requestHeaders) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		policy.setOriginHeaders(w, origin)
+		w.Header().Set("Access-Control-Allow-Methods", policy.allowMethods)
+		if policy.anyHeader {
+			// a literal * is ignored on credentialed requests, echo the requested headers
+			w.Header().Set("Access-Control-Allow-Headers", requestHeaders)
+		} else if policy.allowHeaders != "" {
+			w.Header().Set("Access-Control-Allow-Headers", policy.allowHeaders)
+		}
+		if policy.maxAge != "" {
+			w.Header().Set("Access-Control-Max-Age", policy.maxAge)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// setOriginHeaders allows the origin of a request
+func (p *CORSPolicy) setOriginHeaders(w http.ResponseWriter, origin string) {
+	if p.anyOrigin {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	} else {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+	}
+	if p.allowCredentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+}
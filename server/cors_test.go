@@ -0,0 +1,106 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCORSPolicyOrigins(t *testing.T) {
+	policy, err := NewCORSPolicy(CORSConfig{AllowedOrigins: []string{
+		"https://app.example.com",
+		"https://*.preview.example.com",
+		`regex:https://PR-[0-9]+\.example\.com`,
+	}})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		origin string
+		want   bool
+	}{
+		{"Should allow an exact origin", "https://app.example.com", true},
+		{"Should ignore the origin case", "HTTPS://APP.EXAMPLE.COM", true},
+		{"Should allow a wildcard subdomain", "https://a.b.preview.example.com", true},
+		{"Should not allow the wildcard parent", "https://preview.example.com", false},
+		{"Should allow a regex origin", "https://pr-42.example.com", true},
+		{"Should anchor the regex start", "https://evil.com?https://pr-42.example.com", false},
+		{"Should anchor the regex end", "https://pr-42.example.com.evil.com", false},
+		{"Should not allow another origin", "https://evil.example.com", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, policy.originAllowed(tt.origin))
+		})
+	}
+
+	_, err = NewCORSPolicy(CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true})
+	assert.Error(t, err, "Should reject * with credentials")
+	_, err = NewCORSPolicy(CORSConfig{AllowedOrigins: []string{"regex:("}})
+	assert.Error(t, err, "Should reject an invalid regex")
+}
+
+func TestCORSPolicyMiddleware(t *testing.T) {
+	policy, err := NewCORSPolicy(CORSConfig{
+		AllowedOrigins:   []string{"https://app.example.com"},
+		AllowedMethods:   []string{"GET", "POST"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization"},
+		AllowCredentials: true,
+		Routes: map[string]CORSConfig{
+			"/v1/public/*": {AllowedOrigins: []string{"*"}, AllowedMethods: []string{"GET"}},
+		},
+	})
+	require.NoError(t, err)
+	handler := policy.middleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		headers    map[string]string
+		wantStatus int
+		wantOrigin string
+	}{
+		{"Should allow a simple request", http.MethodGet, "/v1/cart",
+			map[string]string{"Origin": "https://app.example.com"}, http.StatusOK, "https://app.example.com"},
+		{"Should not allow another origin", http.MethodGet, "/v1/cart",
+			map[string]string{"Origin": "https://evil.example.com"}, http.StatusOK, ""},
+		{"Should answer a preflight", http.MethodOptions, "/v1/cart", map[string]string{
+			"Origin": "https://app.example.com", "Access-Control-Request-Method": "POST",
+			"Access-Control-Request-Headers": "content-type",
+		}, http.StatusNoContent, "https://app.example.com"},
+		{"Should reject a preflight from another origin", http.MethodOptions, "/v1/cart", map[string]string{
+			"Origin": "https://evil.example.com", "Access-Control-Request-Method": "POST",
+		}, http.StatusForbidden, ""},
+		{"Should reject a preflight method", http.MethodOptions, "/v1/cart", map[string]string{
+			"Origin": "https://app.example.com", "Access-Control-Request-Method": "DELETE",
+		}, http.StatusForbidden, ""},
+		{"Should reject a preflight header", http.MethodOptions, "/v1/cart", map[string]string{
+			"Origin": "https://app.example.com", "Access-Control-Request-Method": "POST",
+			"Access-Control-Request-Headers": "x-admin",
+		}, http.StatusForbidden, ""},
+		{"Should apply the route override", http.MethodGet, "/v1/public/products",
+			map[string]string{"Origin": "https://evil.example.com"}, http.StatusOK, "*"},
+		{"Should reject a method of the route override", http.MethodOptions, "/v1/public/products", map[string]string{
+			"Origin": "https://app.example.com", "Access-Control-Request-Method": "POST",
+		}, http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, tt.wantOrigin, w.Header().Get("Access-Control-Allow-Origin"))
+		})
+	}
+}
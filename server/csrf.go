@@ -0,0 +1,189 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/cozy-hub-app/framework/jwt"
+	"github.com/cozy-hub-app/framework/middleware"
+)
+
+// csrfHeader carries the token echoed from the CSRF cookie
+const csrfHeader = "X-CSRF-Token"
+
+// CSRFConfig configures CSRFMiddleware
+type CSRFConfig struct {
+	// Protection verifies the signature, expiry and binding of tokens, it is required
+	Protection *middleware.CSRFProtection
+	// JWT validates the bearer token to bind tokens to its user and session, anonymous
+	// requests are bound to X-Session-ID
+	JWT *jwt.JWTManager
+	// Bindings overrides how the user or session of a request is resolved
+	Bindings func(r *http.Request) []middleware.CSRFBinding
+	// AllowedOrigins may send unsafe requests besides the gateway's own origin, e.g. "https://app.example.com"
+	AllowedOrigins []string
+	// ExemptPaths skip the check, e.g. webhooks authenticated by signature; a trailing * matches a prefix
+	ExemptPaths []string
+	// CookieName defaults to middleware.DefaultCSRFCookieName
+	CookieName string
+}
+
+// CSRFMiddleware guards unsafe methods (POST, PUT, PATCH, DELETE...) of the gateway:
+// the Origin, or else Referer, must be allowed, and X-CSRF-Token must match the CSRF cookie
+// and be a valid token of the caller issued by cfg.Protection.IssueToken.
+// Use it with g.WrapHandler(server.CSRFMiddleware(cfg)).
+func CSRFMiddleware(cfg CSRFConfig) func(http.Handler) http.Handler {
+	if cfg.Protection == nil {
+		panic("server: CSRFConfig.Protection is required")
+	}
+	bindings := cfg.Bindings
+	if bindings == nil {
+		bindings = func(r *http.Request) []middleware.CSRFBinding { return requestCSRFBindings(r, cfg.JWT) }
+	}
+
+	cookieName := cfg.CookieName
+	if cookieName == "" {
+		cookieName = middleware.DefaultCSRFCookieName
+	}
+
+	allowed := make(map[string]bool, len(cfg.AllowedOrigins))
+	for _, origin := range cfg.AllowedOrigins {
+		allowed[strings.TrimSuffix(strings.ToLower(strings.TrimSpace(origin)), "/")] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isSafeMethod(r.Method) || isExemptPath(r.URL.Path, cfg.ExemptPaths) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !csrfOriginAllowed(r, allowed) {
+				rejectCSRF(w, r, "cross-origin request rejected")
+				return
+			}
+
+			cookie, err := r.Cookie(cookieName)
+			if err != nil || cookie.Value == "" {
+				rejectCSRF(w, r, "missing CSRF cookie")
+				return
+			}
+
+			token := r.Header.Get(csrfHeader)
+			if token == "" {
+				rejectCSRF(w, r, "missing CSRF token")
+				return
+			}
+
+			if subtle.ConstantTimeCompare([]byte(token), []byte(cookie.Value)) != 1 {
+				rejectCSRF(w, r, "invalid CSRF token")
+				return
+			}
+
+			if err := cfg.Protection.VerifyToken(r.Context(), token, bindings(r)...); err != nil {
+				rejectCSRF(w, r, "invalid CSRF token")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// isSafeMethod reports whether the method is read-only per RFC 9110
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	default:
+		return false
+	}
+}
+
+// isExemptPath reports whether path matches one of the exempt paths
+func isExemptPath(path string, exempt []string) bool {
+	for _, pattern := range exempt {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(path, prefix) {
+				return true
+			}
+		} else if path == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// csrfOriginAllowed checks the Origin header, or the Referer when there is none.
+// Requests with neither come from non-browser clients and rely on the token alone.
+func csrfOriginAllowed(r *http.Request, allowed map[string]bool) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		referer := r.Header.Get("Referer")
+		if referer == "" {
+			return true
+		}
+		u, err := url.Parse(referer)
+		if err != nil || u.Host == "" {
+			return false
+		}
+		origin = u.Scheme + "://" + u.Host
+	}
+
+	// opaque origins (sandboxed frames, file://) are never allowed
+	if origin == "null" {
+		return false
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if strings.EqualFold(u.Scheme, requestScheme(r)) && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	return allowed[strings.ToLower(u.Scheme+"://"+u.Host)]
+}
+
+// requestScheme is https for TLS connections, or the X-Forwarded-Proto set by a trusted proxy
+func requestScheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		if _, trusted, _ := remoteHost(r); trusted {
+			return strings.ToLower(strings.TrimSpace(strings.Split(proto, ",")[0]))
+		}
+	}
+	return "http"
+}
+
+// requestCSRFBindings returns the user and session of a valid, unrevoked bearer access token,
+// or the X-Session-ID session of an anonymous request
+func requestCSRFBindings(r *http.Request, manager *jwt.JWTManager) []middleware.CSRFBinding {
+	if manager != nil {
+		if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			if claims, err := manager.ValidateAccessToken(r.Context(), token); err == nil {
+				bindings := []middleware.CSRFBinding{middleware.UserBinding(claims.UserID)}
+				if claims.SessionID != "" {
+					bindings = append(bindings, middleware.SessionBinding(claims.SessionID))
+				}
+				return bindings
+			}
+		}
+	}
+	if sessionID := r.Header.Get("X-Session-ID"); sessionID != "" {
+		return []middleware.CSRFBinding{middleware.SessionBinding(sessionID)}
+	}
+	return nil
+}
+
+// rejectCSRF writes the framework JSON error body with 403 Forbidden
+func rejectCSRF(w http.ResponseWriter, r *http.Request, message string) {
+	customErrorHandler(r.Context(), nil, nil, w, r, status.Error(codes.PermissionDenied, message))
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cozy-hub-app/framework/jwt"
+	"github.com/cozy-hub-app/framework/middleware"
+)
+
+func TestRequestCSRFBindings(t *testing.T) {
+	manager := jwt.NewJWTManager(strings.Repeat("test-secret-", 6), time.Minute, time.Hour, "test").
+		WithStore(jwt.NewMemoryStore())
+
+	access, refresh, err := manager.GenerateTokenPair("u-1", "u1@example.com", "user")
+	require.NoError(t, err)
+	revoked, _, err := manager.GenerateTokenPair("u-2", "u2@example.com", "user")
+	require.NoError(t, err)
+	require.NoError(t, manager.Revoke(t.Context(), revoked))
+
+	tests := []struct {
+		name  string
+		token string
+		want  []middleware.CSRFBinding
+	}{
+		{"Should bind to the user of an access token only", access, []middleware.CSRFBinding{middleware.UserBinding("u-1")}},
+		{"Should ignore a refresh token", refresh, []middleware.CSRFBinding{middleware.SessionBinding("s-1")}},
+		{"Should ignore a revoked access token", revoked, []middleware.CSRFBinding{middleware.SessionBinding("s-1")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/v1/cart", nil)
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+			r.Header.Set("X-Session-ID", "s-1")
+			assert.Equal(t, tt.want, requestCSRFBindings(r, manager))
+		})
+	}
+}
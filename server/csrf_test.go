@@ -0,0 +1,74 @@
+package server_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cozy-hub-app/framework/middleware"
+	"github.com/cozy-hub-app/framework/server"
+)
+
+func TestCSRFMiddleware(t *testing.T) {
+	protection := middleware.NewCSRFProtection(time.Minute).WithSecret([]byte("test-secret"))
+	t.Cleanup(func() { _ = protection.Close() })
+
+	token, err := protection.GenerateTokenFor(middleware.SessionBinding("s-1"))
+	require.NoError(t, err)
+	other, err := protection.GenerateTokenFor(middleware.SessionBinding("s-1"))
+	require.NoError(t, err)
+	foreign, err := protection.GenerateTokenFor(middleware.SessionBinding("s-2"))
+	require.NoError(t, err)
+
+	handler := server.CSRFMiddleware(server.CSRFConfig{
+		Protection:     protection,
+		AllowedOrigins: []string{"https://app.example.com"},
+		ExemptPaths:    []string{"/v1/webhooks/*"},
+	})(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		origin string
+		cookie string
+		header string
+		want   int
+	}{
+		{"Should pass safe methods", http.MethodGet, "/v1/cart", "https://evil.example.com", "", "", http.StatusOK},
+		{"Should pass exempt paths", http.MethodPost, "/v1/webhooks/stripe", "", "", "", http.StatusOK},
+		{"Should accept a valid token", http.MethodPost, "/v1/cart", "https://api.example.com", token, token, http.StatusOK},
+		{"Should accept an allowed origin", http.MethodPost, "/v1/cart", "https://app.example.com", token, token, http.StatusOK},
+		{"Should reject a bad origin", http.MethodPost, "/v1/cart", "https://evil.example.com", token, token, http.StatusForbidden},
+		{"Should reject another scheme", http.MethodPost, "/v1/cart", "http://api.example.com", token, token, http.StatusForbidden},
+		{"Should reject a missing cookie", http.MethodPost, "/v1/cart", "", "", token, http.StatusForbidden},
+		{"Should reject a mismatched token", http.MethodPost, "/v1/cart", "", token, other, http.StatusForbidden},
+		{"Should reject another session's token", http.MethodPost, "/v1/cart", "", foreign, foreign, http.StatusForbidden},
+		{"Should reject a forged matching pair", http.MethodPost, "/v1/cart", "", "forged", "forged", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "https://api.example.com"+tt.path, nil)
+			r.Header.Set("X-Session-ID", "s-1")
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: middleware.DefaultCSRFCookieName, Value: tt.cookie})
+			}
+			if tt.header != "" {
+				r.Header.Set("X-CSRF-Token", tt.header)
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			assert.Equal(t, tt.want, w.Code)
+		})
+	}
+}
@@ -1,8 +1,10 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"net"
+	"sync"
 
 	"github.com/cozy-hub-app/framework/env"
 	"github.com/cozy-hub-app/framework/logger"
@@ -11,13 +13,25 @@ import (
 
 // GRPCServer wraps gRPC server
 type GRPCServer struct {
+	mu           sync.Mutex
 	server       *grpc.Server
+	stopped      bool
+	ready        chan struct{}
+	noHealth     bool
 	service      interface{}
 	interceptors []grpc.UnaryServerInterceptor
+	streams      []grpc.StreamServerInterceptor
 	logger       logger.Logger
 	registerFunc func(*grpc.Server, interface{})
 }
 
+// serverInterceptor is implemented by middlewares providing both unary and stream
+// interceptors (e.g. *middleware.RateLimiter)
+type serverInterceptor interface {
+	UnaryServerInterceptor() grpc.UnaryServerInterceptor
+	StreamServerInterceptor() grpc.StreamServerInterceptor
+}
+
 // GRPCServiceRegistrar is a function that registers a service with a gRPC server
 type GRPCServiceRegistrar func(*grpc.Server, interface{})
 
@@ -25,16 +39,29 @@ type GRPCServiceRegistrar func(*grpc.Server, interface{})
 func NewGRPC() *GRPCServer {
 	return &GRPCServer{
 		logger:       logger.New(),
+		ready:        make(chan struct{}),
 		interceptors: []grpc.UnaryServerInterceptor{},
+		streams:      []grpc.StreamServerInterceptor{},
 	}
 }
 
 // WithServiceInterceptors adds interceptors to the server
+// Accepts grpc.UnaryServerInterceptor, grpc.StreamServerInterceptor and middlewares
+// exposing both (UnaryServerInterceptor() and StreamServerInterceptor() methods),
+// each kind is chained in the given order
 func (s *GRPCServer) WithServiceInterceptors(interceptors ...interface{}) *GRPCServer {
 	// Convert interface{} to actual gRPC interceptors
 	for _, ipt := range interceptors {
-		if unaryInterceptor, ok := ipt.(grpc.UnaryServerInterceptor); ok {
-			s.interceptors = append(s.interceptors, unaryInterceptor)
+		switch v := ipt.(type) {
+		case grpc.UnaryServerInterceptor:
+			s.interceptors = append(s.interceptors, v)
+		case grpc.StreamServerInterceptor:
+			s.streams = append(s.streams, v)
+		case serverInterceptor:
+			s.interceptors = append(s.interceptors, v.UnaryServerInterceptor())
+			s.streams = append(s.streams, v.StreamServerInterceptor())
+		default:
+			s.logger.Warn("ignoring unsupported interceptor", "type", fmt.Sprintf("%T", ipt))
 		}
 	}
 	return s
@@ -52,6 +79,13 @@ func (s *GRPCServer) WithGRPCRegistrar(fn GRPCServiceRegistrar) *GRPCServer {
 	return s
 }
 
+// WithoutHealthServer disables the built-in grpc.health.v1 service, it is also skipped
+// when the registrar registers its own
+func (s *GRPCServer) WithoutHealthServer() *GRPCServer {
+	s.noHealth = true
+	return s
+}
+
 // ListenAndServe starts the gRPC server
 func (s *GRPCServer) ListenAndServe() error {
 	port := env.GetOrDefault(env.GRPCPort, "50051")
@@ -65,21 +99,75 @@ func (s *GRPCServer) ListenAndServe() error {
 	// Create gRPC server with interceptors
 	opts := []grpc.ServerOption{
 		grpc.ChainUnaryInterceptor(s.interceptors...),
+		grpc.ChainStreamInterceptor(s.streams...),
 	}
-	s.server = grpc.NewServer(opts...)
+	srv := grpc.NewServer(opts...)
 
 	// Register service with gRPC server using the registrar function
 	if s.registerFunc != nil && s.service != nil {
-		s.registerFunc(s.server, s.service)
+		s.registerFunc(srv, s.service)
 	}
 
-	s.logger.Info("gRPC server listening on %s", addr)
-	return s.server.Serve(listener)
+	// Register the standard grpc.health.v1 service
+	if !s.noHealth {
+		registerHealthServer(srv)
+	}
+
+	s.mu.Lock()
+	if s.stopped {
+		// shut down before it started
+		s.mu.Unlock()
+		_ = listener.Close()
+		return nil
+	}
+	s.server = srv
+	close(s.ready)
+	s.mu.Unlock()
+
+	s.logger.Info("gRPC server listening", "addr", addr)
+	return srv.Serve(listener)
+}
+
+// Ready is closed once the server accepts connections
+func (s *GRPCServer) Ready() <-chan struct{} {
+	return s.ready
 }
 
 // Shutdown gracefully shuts down the server
 func (s *GRPCServer) Shutdown() {
-	if s.server != nil {
-		s.server.GracefulStop()
+	if srv := s.stop(); srv != nil {
+		srv.GracefulStop()
+	}
+}
+
+// ShutdownWithContext gracefully shuts down the server and forcefully stops it
+// if in-flight RPCs are still running when ctx is done
+func (s *GRPCServer) ShutdownWithContext(ctx context.Context) error {
+	srv := s.stop()
+	if srv == nil {
+		return nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		srv.Stop()
+		return ctx.Err()
 	}
-}
\ No newline at end of file
+}
+
+// stop marks the server as stopped, so a later ListenAndServe returns at once,
+// and returns the underlying server once ListenAndServe has created it
+func (s *GRPCServer) stop() *grpc.Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopped = true
+	return s.server
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	grpchealth "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+
+	"github.com/cozy-hub-app/framework/health"
+)
+
+// health routes served by the gateway
+const (
+	livenessPath  = "/healthz"
+	readinessPath = "/readyz"
+)
+
+// watchInterval is how often Watch re-evaluates the readiness checks
+const watchInterval = 5 * time.Second
+
+// healthServer implements grpc.health.v1 on top of the health package
+type healthServer struct {
+	grpchealth.UnimplementedHealthServer
+	server *grpc.Server
+}
+
+// registerHealthServer registers the standard gRPC health service unless the service
+// registrar already did
+func registerHealthServer(s *grpc.Server) {
+	if _, ok := s.GetServiceInfo()[grpchealth.Health_ServiceDesc.ServiceName]; ok {
+		return
+	}
+	grpchealth.RegisterHealthServer(s, &healthServer{server: s})
+}
+
+// servingStatus maps readiness to the gRPC health status
+func servingStatus(ctx context.Context) grpchealth.HealthCheckResponse_ServingStatus {
+	if health.Ready(ctx).Ready {
+		return grpchealth.HealthCheckResponse_SERVING
+	}
+	return grpchealth.HealthCheckResponse_NOT_SERVING
+}
+
+// known reports whether service is the overall server ("") or one of its registered services
+func (h *healthServer) known(service string) bool {
+	if service == "" {
+		return true
+	}
+	_, ok := h.server.GetServiceInfo()[service]
+	return ok
+}
+
+// Check reports the aggregated readiness for the server and each of its registered services
+func (h *healthServer) Check(ctx context.Context, req *grpchealth.HealthCheckRequest,
+) (*grpchealth.HealthCheckResponse, error) {
+	if !h.known(req.GetService()) {
+		return nil, status.Errorf(codes.NotFound, "unknown service %q", req.GetService())
+	}
+	return &grpchealth.HealthCheckResponse{Status: servingStatus(ctx)}, nil
+}
+
+// Watch streams the aggregated readiness whenever it changes, SERVICE_UNKNOWN for a service
+// that is not registered
+func (h *healthServer) Watch(req *grpchealth.HealthCheckRequest, stream grpchealth.Health_WatchServer) error {
+	ctx := stream.Context()
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	last := grpchealth.HealthCheckResponse_UNKNOWN
+	for {
+		st := grpchealth.HealthCheckResponse_SERVICE_UNKNOWN
+		if h.known(req.GetService()) {
+			st = servingStatus(ctx)
+		}
+		if st != last {
+			if err := stream.Send(&grpchealth.HealthCheckResponse{Status: st}); err != nil {
+				return err
+			}
+			last = st
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// healthMiddleware serves the liveness and readiness probes ahead of the gateway handlers
+func healthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case livenessPath:
+			// the process answers, so it is alive; draining is reported by readiness only
+			writeHealth(w, http.StatusOK, map[string]string{"status": "ok"})
+
+		case readinessPath:
+			result := health.Ready(r.Context())
+			if result.Ready {
+				writeHealth(w, http.StatusOK, result)
+				return
+			}
+			writeHealth(w, http.StatusServiceUnavailable, result)
+
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// writeHealth writes the probe result as JSON
+func writeHealth(w http.ResponseWriter, code int, result any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	grpchealth "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// watchStream records the first response of Watch and ends the stream
+type watchStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	cancel context.CancelFunc
+	got    *grpchealth.HealthCheckResponse
+}
+
+func (s *watchStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *watchStream) Send(resp *grpchealth.HealthCheckResponse) error {
+	s.got = resp
+	s.cancel()
+	return nil
+}
+
+func TestHealthServerServices(t *testing.T) {
+	srv := grpc.NewServer()
+	registerHealthServer(srv)
+	h := &healthServer{server: srv}
+
+	tests := []struct {
+		name      string
+		service   string
+		wantCode  codes.Code
+		wantWatch grpchealth.HealthCheckResponse_ServingStatus
+	}{
+		{"Should report the overall server", "", codes.OK, grpchealth.HealthCheckResponse_SERVING},
+		{
+			"Should report a registered service",
+			grpchealth.Health_ServiceDesc.ServiceName,
+			codes.OK,
+			grpchealth.HealthCheckResponse_SERVING,
+		},
+		{"Should not find an unknown service", "cart.v1.Unknown", codes.NotFound, grpchealth.HealthCheckResponse_SERVICE_UNKNOWN},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &grpchealth.HealthCheckRequest{Service: tt.service}
+
+			resp, err := h.Check(t.Context(), req)
+			assert.Equal(t, tt.wantCode, status.Code(err))
+			if tt.wantCode == codes.OK {
+				assert.Equal(t, grpchealth.HealthCheckResponse_SERVING, resp.GetStatus())
+			}
+
+			ctx, cancel := context.WithCancel(t.Context())
+			stream := &watchStream{ctx: ctx, cancel: cancel}
+			require.ErrorIs(t, h.Watch(req, stream), context.Canceled)
+			assert.Equal(t, tt.wantWatch, stream.got.GetStatus())
+		})
+	}
+}
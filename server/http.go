@@ -5,13 +5,18 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/netip"
 	"strings"
 	"time"
 
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	"github.com/cozy-hub-app/framework/env"
+	"github.com/cozy-hub-app/framework/jwt"
 	"github.com/cozy-hub-app/framework/logger"
+	"github.com/cozy-hub-app/framework/middleware"
+	"github.com/cozy-hub-app/framework/response"
 	protov1 "github.com/cozy-hub-app/proto/gen/go/proto/v1"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
@@ -26,6 +31,10 @@ type Gateway struct {
 	logger  logger.Logger
 	mux     *runtime.ServeMux
 	ctx     context.Context
+	jwks    *jwt.JWTManager
+	cors    *CORSPolicy
+	cache   *cachePolicies
+	ready   chan struct{}
 }
 
 // ServiceRegistrar defines the interface for service registration
@@ -33,63 +42,11 @@ type ServiceRegistrar interface {
 	RegisterWithHandler(ctx context.Context, mux *runtime.ServeMux, conn *grpc.ClientConn) error
 }
 
-// corsMiddleware adds CORS headers to allow frontend requests
-func corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Allow requests from frontend origins
-		origin := r.Header.Get("Origin")
-
-		// Get allowed origins from environment variable or use defaults
-		allowedOriginsEnv := env.GetOrDefault("CORS_ALLOWED_ORIGINS", "")
-		allowedOrigins := []string{
-			"http://localhost:8000",
-			"http://localhost:3000",
-			"http://localhost:5173", // Vite default
-			"http://localhost:8083", // Admin dashboard
-		}
-
-		// Parse additional origins from environment variable (comma-separated)
-		if allowedOriginsEnv != "" {
-			envOrigins := strings.Split(allowedOriginsEnv, ",")
-			for _, o := range envOrigins {
-				trimmed := strings.TrimSpace(o)
-				if trimmed != "" {
-					allowedOrigins = append(allowedOrigins, trimmed)
-				}
-			}
-		}
-
-		// Check if origin is allowed
-		for _, allowed := range allowedOrigins {
-			if origin == allowed {
-				w.Header().Set("Access-Control-Allow-Origin", origin)
-				break
-			}
-		}
-
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With, X-Session-ID")
-		w.Header().Set("Access-Control-Allow-Credentials", "true")
-
-		// Disable caching for API responses to ensure fresh data (especially inventory)
-		w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
-		w.Header().Set("Pragma", "no-cache")
-		w.Header().Set("Expires", "0")
-
-		// Handle preflight OPTIONS request
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-
-		// Continue with the next handler
-		next.ServeHTTP(w, r)
-	})
-}
-
 // customErrorHandler handles gRPC errors and removes @type from details
-func customErrorHandler(_ context.Context, _ *runtime.ServeMux, _ runtime.Marshaler, w http.ResponseWriter, _ *http.Request, err error) {
+func customErrorHandler(ctx context.Context, _ *runtime.ServeMux, _ runtime.Marshaler, w http.ResponseWriter, _ *http.Request, err error) {
 	w.Header().Set("Content-Type", "application/json")
+	forwardErrorMetadata(ctx, w)
+	response.SetErrorHeaders(w, err)
 
 	// Convert error to gRPC status
 	st := status.Convert(err)
@@ -128,11 +85,48 @@ func customErrorHandler(_ context.Context, _ *runtime.ServeMux, _ runtime.Marsha
 	_, _ = w.Write(buf)
 }
 
+// forwardErrorMetadata copies the allowed header and trailer metadata of a failed call
+// (e.g. Retry-After and X-RateLimit-* of a rate limited call) to the HTTP error response
+func forwardErrorMetadata(ctx context.Context, w http.ResponseWriter) {
+	md, ok := runtime.ServerMetadataFromContext(ctx)
+	if !ok {
+		return
+	}
+
+	for _, source := range []map[string][]string{md.HeaderMD, md.TrailerMD} {
+		for key, values := range source {
+			name, ok := outgoingHeaderMatcher(key)
+			if !ok || strings.HasPrefix(name, runtime.MetadataHeaderPrefix) {
+				continue
+			}
+			for _, value := range values {
+				w.Header().Add(name, value)
+			}
+		}
+	}
+}
+
 // outgoingHeaderMatcher allows specific headers (like Set-Cookie) to be forwarded from gRPC to HTTP
 func outgoingHeaderMatcher(key string) (string, bool) {
 	switch key {
 	case "set-cookie":
 		return "Set-Cookie", true
+	case "x-ratelimit-limit":
+		return "X-RateLimit-Limit", true
+	case "x-ratelimit-remaining":
+		return "X-RateLimit-Remaining", true
+	case "x-ratelimit-reset":
+		return "X-RateLimit-Reset", true
+	case "retry-after":
+		return "Retry-After", true
+	case "x-csrf-token":
+		return "X-CSRF-Token", true
+	case "cache-control":
+		return "Cache-Control", true
+	case "etag":
+		return "ETag", true
+	case "last-modified":
+		return "Last-Modified", true
 	default:
 		return runtime.DefaultHeaderMatcher(key)
 	}
@@ -160,25 +154,78 @@ func incomingHeaderMatcher(key string) (string, bool) {
 	case "x-session-id":
 		// Forward session ID header for guest cart operations
 		return "x-session-id", true
+	case "x-api-key":
+		// Forward API key header, used as a rate limit key by middleware.PolicyRateLimiter
+		return "x-api-key", true
+	case "x-csrf-token":
+		// Forward CSRF token header, validated by middleware.CSRFProtection
+		return "x-csrf-token", true
+	case "forwarded", "x-real-ip":
+		// Forward proxy headers, sanitized by proxyHeadersMiddleware; only the configured one is honored
+		// (see middleware.TrustedProxies)
+		return lowerKey, true
 	default:
 		return runtime.DefaultHeaderMatcher(key)
 	}
 }
 
+// proxyHeadersMiddleware appends the HTTP peer to an RFC 7239 Forwarded header, as the runtime
+// does for X-Forwarded-For, and overwrites X-Real-IP with the peer unless it is a trusted proxy,
+// so a client connecting to the gateway cannot forge the address seen by the gRPC server
+// (see TRUSTED_PROXY_HEADER)
+func proxyHeadersMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if host, trusted, ok := remoteHost(r); ok {
+			node := host
+			if strings.Contains(host, ":") {
+				node = `"[` + host + `]"`
+			}
+			if fwd := r.Header.Values("Forwarded"); len(fwd) > 0 {
+				r.Header.Set("Forwarded", strings.Join(fwd, ", ")+", for="+node)
+			} else {
+				r.Header.Set("Forwarded", "for="+node)
+			}
+
+			if !trusted {
+				r.Header.Set("X-Real-IP", host)
+			}
+		} else {
+			r.Header.Del("X-Real-IP")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// remoteHost returns the host of the HTTP peer and whether it is a trusted proxy
+func remoteHost(r *http.Request) (host string, trusted bool, ok bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return "", false, false
+	}
+	addr, err := netip.ParseAddr(host)
+	return host, err == nil && middleware.GetTrustedProxies().Contains(addr), true
+}
+
 // NewGateway creates a new HTTP gateway
 func NewGateway(ctx context.Context) (*Gateway, error) {
+	g := &Gateway{
+		logger: logger.FromContext(ctx),
+		ctx:    ctx,
+		cache:  newCachePolicies(),
+		ready:  make(chan struct{}),
+	}
+
 	// Create gRPC-gateway runtime mux with custom error handler and metadata forwarders
-	mux := runtime.NewServeMux(
+	g.mux = runtime.NewServeMux(
 		runtime.WithErrorHandler(customErrorHandler),
 		runtime.WithOutgoingHeaderMatcher(outgoingHeaderMatcher),
 		runtime.WithIncomingHeaderMatcher(incomingHeaderMatcher),
+		runtime.WithForwardResponseOption(g.forwardCachePolicy),
+		// records the status of response.Created and response.Accepted for response.StatusHandler
+		runtime.WithForwardResponseOption(response.ForwardResponseOption),
 	)
 
-	return &Gateway{
-		logger: logger.FromContext(ctx),
-		mux:    mux,
-		ctx:    ctx,
-	}, nil
+	return g, nil
 }
 
 // WithServiceHandler registers the service handler
@@ -205,8 +252,17 @@ func (g *Gateway) WithServiceHandler(ctx context.Context, svc interface{}) (*Gat
 		}
 	}
 
-	// Wrap mux with CORS middleware
-	corsHandler := corsMiddleware(g.mux)
+	// CORS is parsed once, from env unless WithCORS was called
+	if g.cors == nil {
+		policy, err := NewCORSPolicy(CORSConfigFromEnv())
+		if err != nil {
+			return nil, fmt.Errorf("invalid CORS configuration: %w", err)
+		}
+		g.cors = policy
+	}
+
+	// Wrap mux with CORS and cache middlewares, health probes and the JWKS document are served ahead of them
+	corsHandler := healthMiddleware(g.jwksMiddleware(g.cors.middleware(g.cacheMiddleware(proxyHeadersMiddleware(response.StatusHandler(g.mux))))))
 
 	// Create HTTP server
 	port := env.GetOrDefault(env.ServerPort, "8080")
@@ -229,8 +285,19 @@ func (g *Gateway) WrapHandler(wrapper func(http.Handler) http.Handler) {
 
 // ListenAndServe starts the HTTP server
 func (g *Gateway) ListenAndServe() error {
-	g.logger.Info("HTTP server listening on %s", g.server.Addr)
-	return g.server.ListenAndServe()
+	listener, err := net.Listen("tcp", g.server.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", g.server.Addr, err)
+	}
+	close(g.ready)
+
+	g.logger.Info("HTTP server listening", "addr", g.server.Addr)
+	return g.server.Serve(listener)
+}
+
+// Ready is closed once the server accepts connections
+func (g *Gateway) Ready() <-chan struct{} {
+	return g.ready
 }
 
 // Shutdown gracefully shuts down the server
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+
+	"github.com/cozy-hub-app/framework/middleware"
+)
+
+func TestProxyHeadersMiddlewareRealIP(t *testing.T) {
+	proxies, err := middleware.ParseTrustedProxies("10.0.0.0/8")
+	require.NoError(t, err)
+	proxies.WithHeader(middleware.ProxyHeaderXRealIP)
+	previous := middleware.GetTrustedProxies()
+	middleware.SetTrustedProxies(proxies)
+	t.Cleanup(func() { middleware.SetTrustedProxies(previous) })
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		realIP     string
+		want       string
+	}{
+		{"Should overwrite a forged header from an untrusted client", "203.0.113.7:5000", "198.51.100.1", "203.0.113.7"},
+		{"Should set the header for an untrusted client", "203.0.113.7:5000", "", "203.0.113.7"},
+		{"Should keep the header set by a trusted proxy", "10.0.0.2:5000", "198.51.100.1", "198.51.100.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var forwarded string
+			handler := proxyHeadersMiddleware(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				forwarded = r.Header.Get("X-Real-IP")
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/v1/cart", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+
+			// the gateway reaches the gRPC server over loopback with the header as metadata
+			ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1}})
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("x-real-ip", forwarded))
+			ip, err := proxies.ClientIP(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, netip.MustParseAddr(tt.want), ip)
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/cozy-hub-app/framework/jwt"
+)
+
+// jwksPath is the well-known route of the JWKS document
+const jwksPath = "/.well-known/jwks.json"
+
+// jwksCacheControl lets verifiers cache the key set between rotations
+const jwksCacheControl = "public, max-age=300"
+
+// WithJWKS publishes the public keys of m at /.well-known/jwks.json
+// so other services can verify tokens without the signing keys
+func (g *Gateway) WithJWKS(m *jwt.JWTManager) *Gateway {
+	g.jwks = m
+	return g
+}
+
+// jwksMiddleware serves the JWKS document ahead of the gateway handlers
+func (g *Gateway) jwksMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if g.jwks == nil || r.URL.Path != jwksPath {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", jwksCacheControl)
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(g.jwks.JWKS())
+	})
+}
@@ -1,6 +1,8 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	_ "net/http/pprof"
 
@@ -8,15 +10,38 @@ import (
 	"github.com/cozy-hub-app/framework/logger"
 )
 
-// RunProfiler starts the profiler server
-func RunProfiler() {
+// Profiler wraps the pprof HTTP server
+type Profiler struct {
+	server *http.Server
+	logger logger.Logger
+}
+
+// NewProfiler creates a new profiler server
+func NewProfiler() *Profiler {
 	port := env.GetOrDefault("PROFILER_PORT", "6060")
-	addr := ":" + port
 
-	log := logger.New()
-	log.Info("profiler server listening on %s", addr)
+	return &Profiler{
+		// pprof handlers are registered on the default mux
+		server: &http.Server{Addr: ":" + port, Handler: http.DefaultServeMux},
+		logger: logger.New(),
+	}
+}
+
+// ListenAndServe starts the profiler server
+func (p *Profiler) ListenAndServe() error {
+	p.logger.Info("profiler server listening", "addr", p.server.Addr)
+	return p.server.ListenAndServe()
+}
+
+// Shutdown gracefully shuts down the profiler server
+func (p *Profiler) Shutdown(ctx context.Context) error {
+	return p.server.Shutdown(ctx)
+}
 
-	if err := http.ListenAndServe(addr, nil); err != nil {
-		log.Error("profiler server failed: %v", err)
+// RunProfiler starts the profiler server
+func RunProfiler() {
+	p := NewProfiler()
+	if err := p.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		p.logger.Error("profiler server failed", "error", err)
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"sort"
+	"strings"
+)
+
+// routeTable resolves a value per path or gRPC method: exact match, then the longest
+// prefix pattern ending with *
+type routeTable[T any] struct {
+	exact    map[string]T
+	prefixes map[string]T
+	// ordered longest first
+	order []string
+}
+
+// newRouteTable creates an empty table
+func newRouteTable[T any]() *routeTable[T] {
+	return &routeTable[T]{
+		exact:    make(map[string]T),
+		prefixes: make(map[string]T),
+	}
+}
+
+// set binds v to an exact pattern or to a prefix pattern ending with *
+func (t *routeTable[T]) set(pattern string, v T) {
+	prefix, ok := strings.CutSuffix(pattern, "*")
+	if !ok {
+		t.exact[pattern] = v
+		return
+	}
+
+	if _, exists := t.prefixes[prefix]; !exists {
+		t.order = append(t.order, prefix)
+		sort.Slice(t.order, func(i, j int) bool { return len(t.order[i]) > len(t.order[j]) })
+	}
+	t.prefixes[prefix] = v
+}
+
+// lookup returns the value bound to key
+func (t *routeTable[T]) lookup(key string) (T, bool) {
+	if v, ok := t.exact[key]; ok {
+		return v, true
+	}
+	for _, prefix := range t.order {
+		if strings.HasPrefix(key, prefix) {
+			return t.prefixes[prefix], true
+		}
+	}
+
+	var zero T
+	return zero, false
+}